@@ -2,86 +2,774 @@ package shack
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	stdlog "log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/ichxxx/shack/logger"
 	jsoniter "github.com/json-iterator/go"
 )
 
 type (
 	// Map is a shortcut for map[string]interface{}
-	Map     map[string]interface{}
+	Map map[string]interface{}
+	// M is a short alias of Map.
+	M       = Map
 	Handler func(*Context)
 )
 
 var (
 	json                     = jsoniter.ConfigCompatibleWithStandardLibrary
 	MaxMultipartMemory int64 = 8 << 20
-	runningApps              = make(map[string]*http.Server)
-	appMutex                 = sync.Mutex{}
+	// legacyApps are the running apps looked up by the package level
+	// Shutdown, Ready and ReadinessHandler, the apps don't depend on it.
+	legacyApps = make(map[*App]struct{})
+	appMutex   = sync.Mutex{}
 )
 
 type Option struct {
+	// ShutdownFunc runs after the shutdown hooks.
+	//
+	// Deprecated: use ShutdownHooks, which can return errors and have timeouts.
 	ShutdownFunc func()
+	// HandleSignals makes Run shut down gracefully on SIGINT and SIGTERM.
+	HandleSignals bool
+	// DrainTimeout is the max duration to wait for the in-flight requests
+	// while shutting down, the connections are closed after it.
+	// Zero means waiting until all requests are done.
+	DrainTimeout time.Duration
+	// DrainDelay is the duration to keep serving after the app is marked
+	// draining and before the listeners are closed, so the load balancers
+	// see the readiness probe failing and stop sending new requests.
+	DrainDelay time.Duration
+	// ShutdownHooks run in order after draining, the hooks of multiple
+	// options are appended.
+	ShutdownHooks []ShutdownHook
+
+	// ReadTimeout, ReadHeaderTimeout, WriteTimeout, IdleTimeout and
+	// MaxHeaderBytes are the same as the ones of http.Server,
+	// zero means the default of http.Server.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	// ErrorLog logs the errors of accepting connections, unexpected
+	// behavior from handlers, and underlying file system errors.
+	// The errors are logged by the shack logger if it's nil.
+	ErrorLog *stdlog.Logger
+	// BaseContext and ConnContext are the same as the ones of http.Server.
+	BaseContext func(net.Listener) context.Context
+	ConnContext func(ctx context.Context, c net.Conn) context.Context
+	// Listener is used by Run and RunTLS to accept connections instead
+	// of listening on the addr.
+	Listener net.Listener
+
+	// TLSConfig is the base config of RunTLS, it's cloned before use.
+	TLSConfig *tls.Config
+	// ClientCAFile is the PEM file of the CAs verifying the client
+	// certificates for RunTLS, setting it enables mutual TLS, and the
+	// client certificates are required unless TLSConfig.ClientAuth is set.
+	ClientCAFile string
 }
 
-var defaultOpt = Option{
-	ShutdownFunc: func() {},
+// ShutdownHook runs after the server is drained.
+type ShutdownHook struct {
+	Name string
+	// Timeout is the max duration of the hook, zero means no timeout.
+	// Each hook gets its own context, regardless of the time spent on
+	// draining.
+	Timeout time.Duration
+	Fn      func(ctx context.Context) error
 }
 
-func Run(addr string, router *Router, opts ...Option) error {
-	if len(opts) == 0 {
-		opts = append(opts, defaultOpt)
+// ShutdownError is returned if draining or any shutdown hook fails.
+type ShutdownError struct {
+	Errors []error
+}
+
+func (e *ShutdownError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return "shack: shutdown failed: " + strings.Join(messages, "; ")
+}
+
+// Is reports whether any of the errors matches target, so errors.Is
+// works on the Go versions without multiple wrapped errors.
+func (e *ShutdownError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors matching target like errors.As.
+func (e *ShutdownError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *ShutdownError) Unwrap() []error {
+	return e.Errors
+}
+
+// mergeOptions merges the options, the non-zero fields of the latter
+// options override the former ones, and the hooks are appended.
+func mergeOptions(opts []Option) Option {
+	var opt Option
+	var funcs []func()
+	for _, o := range opts {
+		if o.ShutdownFunc != nil {
+			funcs = append(funcs, o.ShutdownFunc)
+		}
+		if o.HandleSignals {
+			opt.HandleSignals = true
+		}
+		if o.DrainTimeout > 0 {
+			opt.DrainTimeout = o.DrainTimeout
+		}
+		if o.DrainDelay > 0 {
+			opt.DrainDelay = o.DrainDelay
+		}
+		opt.ShutdownHooks = append(opt.ShutdownHooks, o.ShutdownHooks...)
+		if o.ReadTimeout > 0 {
+			opt.ReadTimeout = o.ReadTimeout
+		}
+		if o.ReadHeaderTimeout > 0 {
+			opt.ReadHeaderTimeout = o.ReadHeaderTimeout
+		}
+		if o.WriteTimeout > 0 {
+			opt.WriteTimeout = o.WriteTimeout
+		}
+		if o.IdleTimeout > 0 {
+			opt.IdleTimeout = o.IdleTimeout
+		}
+		if o.MaxHeaderBytes > 0 {
+			opt.MaxHeaderBytes = o.MaxHeaderBytes
+		}
+		if o.ErrorLog != nil {
+			opt.ErrorLog = o.ErrorLog
+		}
+		if o.BaseContext != nil {
+			opt.BaseContext = o.BaseContext
+		}
+		if o.ConnContext != nil {
+			opt.ConnContext = o.ConnContext
+		}
+		if o.Listener != nil {
+			opt.Listener = o.Listener
+		}
+		if o.TLSConfig != nil {
+			opt.TLSConfig = o.TLSConfig
+		}
+		if len(o.ClientCAFile) > 0 {
+			opt.ClientCAFile = o.ClientCAFile
+		}
 	}
-	for _, opt := range opts {
-		defer opt.ShutdownFunc()
+	for _, fn := range funcs {
+		fn := fn
+		opt.ShutdownHooks = append(opt.ShutdownHooks, ShutdownHook{Name: "ShutdownFunc", Fn: func(context.Context) error {
+			fn()
+			return nil
+		}})
 	}
+	return opt
+}
 
+// newServer returns a http.Server configured by opt.
+func newServer(addr string, handler http.Handler, opt Option) *http.Server {
 	server := &http.Server{
-		Addr:    addr,
-		Handler: router,
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       opt.ReadTimeout,
+		ReadHeaderTimeout: opt.ReadHeaderTimeout,
+		WriteTimeout:      opt.WriteTimeout,
+		IdleTimeout:       opt.IdleTimeout,
+		MaxHeaderBytes:    opt.MaxHeaderBytes,
+		ErrorLog:          opt.ErrorLog,
+		BaseContext:       opt.BaseContext,
+		ConnContext:       opt.ConnContext,
+	}
+	if server.ErrorLog == nil {
+		server.ErrorLog = stdlog.New(serverErrorWriter{}, "", 0)
+	}
+	return server
+}
+
+// serverErrorWriter writes the errors of http.Server to the shack logger.
+type serverErrorWriter struct{}
+
+func (serverErrorWriter) Write(p []byte) (int, error) {
+	logger.Error(strings.TrimSpace(string(p)), "source", "http.Server")
+	return len(p), nil
+}
+
+// Run listens on the TCP network address addr and serves the router,
+// it blocks until the server is shut down by Shutdown, or by the signals
+// if Option.HandleSignals is set, and returns the error of listening or
+// shutting down.
+// If Option.Listener is set, it's used instead of listening on addr,
+// and addr can be empty to use the address of the listener.
+// It's a shortcut of App serving a single router.
+func Run(addr string, router *Router, opts ...Option) error {
+	app := NewApp(opts...)
+	app.add(&appListener{network: "tcp", addr: addr, ln: app.opt.Listener, handler: router})
+	return app.run()
+}
+
+// AppState is the state of App.
+type AppState int32
+
+const (
+	// StateStarting is the state of a new app until it serves.
+	StateStarting AppState = iota
+	// StateRunning means the app is serving.
+	StateRunning
+	// StateDraining means the app is waiting for the in-flight requests
+	// and running the shutdown hooks.
+	StateDraining
+	// StateStopped means the app is stopped, or failed to start.
+	StateStopped
+)
+
+func (s AppState) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// App serves the routers on its listeners, which can be TCP addresses,
+// unix sockets, TLS or pre-opened files, and manages the lifecycle of
+// them. Each app is independent, so multiple apps can run in a process.
+type App struct {
+	opt        Option
+	mutex      sync.Mutex
+	started    bool
+	listeners  []*appListener
+	startHooks []func(ctx context.Context) error
+	stopHooks  []ShutdownHook
+	state      int32
+	ready      chan struct{}
+	done       chan struct{}
+	stopOnce   sync.Once
+	serveErr   error
+	stopErr    error
+}
+
+// appListener is a listener of App and the server on it.
+type appListener struct {
+	network  string
+	addr     string
+	fd       uintptr
+	ln       net.Listener
+	handler  http.Handler
+	tls      bool
+	certFile string
+	keyFile  string
+	server   *http.Server
+	reloader *certReloader
+}
+
+// NewApp returns an App configured by the options, which are merged
+// like the ones of Run.
+func NewApp(opts ...Option) *App {
+	opt := mergeOptions(opts)
+	return &App{
+		opt:       opt,
+		stopHooks: opt.ShutdownHooks,
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Listen serves the router on the TCP network address addr.
+func (a *App) Listen(addr string, router *Router) *App {
+	return a.add(&appListener{network: "tcp", addr: addr, handler: router})
+}
+
+// ListenTLS serves the router over HTTPS on the TCP network address addr,
+// the certificate is reloaded once the files change like RunTLS.
+func (a *App) ListenTLS(addr, certFile, keyFile string, router *Router) *App {
+	return a.add(&appListener{network: "tcp", addr: addr, handler: router, tls: true, certFile: certFile, keyFile: keyFile})
+}
+
+// ListenUnix serves the router on the unix socket of path.
+func (a *App) ListenUnix(path string, router *Router) *App {
+	return a.add(&appListener{network: "unix", addr: path, handler: router})
+}
+
+// ListenFD serves the router on the listener of the pre-opened file
+// descriptor fd, like the ones passed by systemd socket activation.
+func (a *App) ListenFD(fd uintptr, router *Router) *App {
+	return a.add(&appListener{network: "fd", fd: fd, handler: router})
+}
+
+// Serve serves the router on the listener ln, which is closed once
+// the app stops.
+func (a *App) Serve(ln net.Listener, router *Router) *App {
+	return a.add(&appListener{network: ln.Addr().Network(), ln: ln, handler: router})
+}
+
+func (a *App) add(l *appListener) *App {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.started {
+		panic("shack: listeners can't be added after the app started")
+	}
+	a.listeners = append(a.listeners, l)
+	return a
+}
+
+// OnStart adds the hooks running in order before the listeners are
+// opened, the app fails to start if any of them fails.
+func (a *App) OnStart(hooks ...func(ctx context.Context) error) *App {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.startHooks = append(a.startHooks, hooks...)
+	return a
+}
+
+// OnStop adds the hooks running in order after the app is drained,
+// they run after Option.ShutdownHooks.
+func (a *App) OnStop(hooks ...ShutdownHook) *App {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.stopHooks = append(a.stopHooks, hooks...)
+	return a
+}
+
+// Start runs the start hooks with ctx, opens the listeners and serves
+// them in background. It returns once the app is running, or the error
+// if any hook or listener fails, and then the app is stopped.
+// The app is stopped on the signals if Option.HandleSignals is set.
+func (a *App) Start(ctx context.Context) error {
+	a.mutex.Lock()
+	if a.started {
+		a.mutex.Unlock()
+		return errors.New("shack: app can't be started twice")
+	}
+	a.started = true
+	listeners, startHooks := a.listeners, a.startHooks
+	a.mutex.Unlock()
+
+	if len(listeners) == 0 {
+		return a.abort(errors.New("shack: app has no listener"))
+	}
+	for _, hook := range startHooks {
+		if err := hook(ctx); err != nil {
+			return a.abort(fmt.Errorf("shack: start hook: %w", err))
+		}
+	}
+	for _, l := range listeners {
+		if err := l.open(a.opt); err != nil {
+			return a.abort(err)
+		}
+	}
+
+	addApp(a)
+	atomic.StoreInt32(&a.state, int32(StateRunning))
+	close(a.ready)
+	for _, l := range listeners {
+		l := l
+		go func() {
+			if err := l.serve(); err != nil && err != http.ErrServerClosed {
+				a.fail(err)
+			}
+		}()
+	}
+	if a.opt.HandleSignals {
+		go a.handleSignals()
+	}
+	return nil
+}
+
+func (a *App) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case <-signals:
+		_ = a.Stop(context.Background())
+	case <-a.done:
 	}
-	addRunningApp(addr, server)
-	return server.ListenAndServe()
 }
 
-func addRunningApp(addr string, app *http.Server) {
+// abort stops the app failed to start.
+func (a *App) abort(err error) error {
+	a.stopOnce.Do(func() {
+		for _, l := range a.listeners {
+			l.close()
+		}
+		a.stopErr = err
+		atomic.StoreInt32(&a.state, int32(StateStopped))
+		close(a.done)
+	})
+	return err
+}
+
+// fail records the error of serving and stops the app.
+func (a *App) fail(err error) {
+	a.mutex.Lock()
+	if a.serveErr == nil {
+		a.serveErr = err
+	}
+	a.mutex.Unlock()
+	go func() {
+		_ = a.Stop(context.Background())
+	}()
+}
+
+// Stop gracefully stops the app, it flips the app to draining, keeps
+// serving for the drain delay, waits for the in-flight requests until
+// ctx is done or the drain timeout, then runs the shutdown hooks in
+// order, each with its own timeout.
+// It only runs once, and the later calls wait for the first one.
+func (a *App) Stop(ctx context.Context) error {
+	a.stopOnce.Do(func() {
+		a.stop(ctx)
+	})
+	<-a.done
+	return a.stopErr
+}
+
+func (a *App) stop(ctx context.Context) {
+	defer close(a.done)
+	defer removeApp(a)
+
+	a.mutex.Lock()
+	a.started = true
+	listeners, hooks := a.listeners, a.stopHooks
+	a.mutex.Unlock()
+	atomic.StoreInt32(&a.state, int32(StateDraining))
+
+	if a.opt.DrainDelay > 0 {
+		timer := time.NewTimer(a.opt.DrainDelay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	}
+
+	drainCtx, cancel := ctx, context.CancelFunc(func() {})
+	if a.opt.DrainTimeout > 0 {
+		drainCtx, cancel = context.WithTimeout(ctx, a.opt.DrainTimeout)
+	}
+	var wg sync.WaitGroup
+	drainErrs := make([]error, len(listeners))
+	for i, l := range listeners {
+		if l.server == nil {
+			continue
+		}
+		i, l := i, l
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.server.Shutdown(drainCtx); err != nil {
+				drainErrs[i] = fmt.Errorf("shack: drain: %w", err)
+				_ = l.server.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	cancel()
+
+	var errs []error
+	for i, l := range listeners {
+		l.close()
+		if drainErrs[i] != nil {
+			errs = append(errs, drainErrs[i])
+		}
+	}
+	for _, hook := range hooks {
+		if err := runShutdownHook(hook); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		a.stopErr = &ShutdownError{Errors: errs}
+	}
+	atomic.StoreInt32(&a.state, int32(StateStopped))
+}
+
+// Wait blocks until the app is stopped, and returns the error of serving,
+// or the error of stopping.
+func (a *App) Wait() error {
+	<-a.done
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.serveErr != nil {
+		return a.serveErr
+	}
+	return a.stopErr
+}
+
+// run starts the app and waits until it's stopped.
+func (a *App) run() error {
+	if err := a.Start(context.Background()); err != nil {
+		return err
+	}
+	return a.Wait()
+}
+
+// State returns the current state of the app.
+func (a *App) State() AppState {
+	return AppState(atomic.LoadInt32(&a.state))
+}
+
+// Ready returns a channel closed once the app is running.
+func (a *App) Ready() <-chan struct{} {
+	return a.ready
+}
+
+// Done returns a channel closed once the app is stopped.
+func (a *App) Done() <-chan struct{} {
+	return a.done
+}
+
+// Addrs returns the addresses of the listeners, it's useful to get
+// the port chosen by the system for `:0`. It's empty before running.
+func (a *App) Addrs() []net.Addr {
+	select {
+	case <-a.ready:
+	default:
+		return nil
+	}
+	addrs := make([]net.Addr, len(a.listeners))
+	for i, l := range a.listeners {
+		addrs[i] = l.ln.Addr()
+	}
+	return addrs
+}
+
+// hasAddr reports whether the app listens on addr, which is compared
+// with both the given address and the actual one.
+func (a *App) hasAddr(addr string) bool {
+	for _, l := range a.listeners {
+		if (len(l.addr) > 0 && l.addr == addr) || (l.ln != nil && l.ln.Addr().String() == addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *App) hasServer(server *http.Server) bool {
+	for _, l := range a.listeners {
+		if l.server == server {
+			return true
+		}
+	}
+	return false
+}
+
+// open opens the listener if it isn't pre-opened, and prepares its server.
+func (l *appListener) open(opt Option) error {
+	if l.ln == nil {
+		var err error
+		if l.network == "fd" {
+			f := os.NewFile(l.fd, "fd"+strconv.Itoa(int(l.fd)))
+			if f == nil {
+				return fmt.Errorf("shack: invalid file descriptor %d", l.fd)
+			}
+			l.ln, err = net.FileListener(f)
+			_ = f.Close()
+		} else {
+			l.ln, err = net.Listen(l.network, l.addr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	addr := l.addr
+	if len(addr) == 0 {
+		addr = l.ln.Addr().String()
+	}
+	server := newServer(addr, l.handler, opt)
+	if l.tls {
+		tlsConfig, reloader, err := newTLSConfig(l.certFile, l.keyFile, opt)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+		l.reloader = reloader
+	}
+	l.server = server
+	return nil
+}
+
+func (l *appListener) serve() error {
+	if l.server.TLSConfig != nil {
+		return l.server.ServeTLS(l.ln, "", "")
+	}
+	return l.server.Serve(l.ln)
+}
+
+func (l *appListener) close() {
+	if l.ln != nil {
+		_ = l.ln.Close()
+	}
+	if l.reloader != nil {
+		_ = l.reloader.Close()
+	}
+}
+
+// runShutdownHook runs the hook with a new context rather than the one
+// of Stop, which may be used up by draining.
+func runShutdownHook(hook ShutdownHook) error {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if hook.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+	}
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.Fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("shack: shutdown hook '%s': %w", hook.Name, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("shack: shutdown hook '%s': %w", hook.Name, ctx.Err())
+	}
+}
+
+func addApp(app *App) {
 	appMutex.Lock()
-	runningApps[addr] = app
+	legacyApps[app] = struct{}{}
 	appMutex.Unlock()
 }
 
-func Shutdown(addrs ...string) {
+func removeApp(app *App) {
 	appMutex.Lock()
-	defer appMutex.Unlock()
+	delete(legacyApps, app)
+	appMutex.Unlock()
+}
 
-	wg := sync.WaitGroup{}
-	if len(addrs) > 0 {
-		wg.Add(len(addrs))
+// Shutdown gracefully stops the running apps listening on the addrs,
+// or all the running apps if no addr is given, and returns the combined
+// error. The unknown addrs are ignored.
+func Shutdown(addrs ...string) error {
+	appMutex.Lock()
+	var apps []*App
+	for app := range legacyApps {
+		if len(addrs) == 0 {
+			apps = append(apps, app)
+			continue
+		}
 		for _, addr := range addrs {
-			_addr := addr
-			go func() {
-				_ = shutdownRunningApp(runningApps[_addr])
-				wg.Done()
-			}()
-			delete(runningApps, addr)
+			if app.hasAddr(addr) {
+				apps = append(apps, app)
+				break
+			}
 		}
+	}
+	appMutex.Unlock()
 
-	} else {
-		wg.Add(len(runningApps))
-		for _, app := range runningApps {
-			_app := app
-			go func() {
-				_ = shutdownRunningApp(_app)
-				wg.Done()
-			}()
+	var wg sync.WaitGroup
+	errs := make([]error, len(apps))
+	wg.Add(len(apps))
+	for i, app := range apps {
+		i, app := i, app
+		go func() {
+			defer wg.Done()
+			errs[i] = app.Stop(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	var shutdownErr ShutdownError
+	for _, err := range errs {
+		if err != nil {
+			shutdownErr.Errors = append(shutdownErr.Errors, err)
 		}
-		runningApps = make(map[string]*http.Server)
 	}
+	if len(shutdownErr.Errors) > 0 {
+		return &shutdownErr
+	}
+	return nil
+}
 
-	wg.Wait()
+// Ready reports whether the app listening on addr is running, it's not
+// ready once draining.
+func Ready(addr string) bool {
+	appMutex.Lock()
+	defer appMutex.Unlock()
+	for app := range legacyApps {
+		if app.hasAddr(addr) && app.State() == StateRunning {
+			return true
+		}
+	}
+	return false
 }
 
-func shutdownRunningApp(app *http.Server) error {
-	return app.Shutdown(context.Background())
+// ReadinessHandler returns a handler responding 200 if the app serving
+// the request is running, or 503 once it's draining.
+//
+// Deprecated: use App.ReadinessHandler, this one looks up the app by the
+// server of request among the running apps.
+func ReadinessHandler() Handler {
+	return func(ctx *Context) {
+		server, _ := ctx.Request.Context().Value(http.ServerContextKey).(*http.Server)
+		ready := false
+		appMutex.Lock()
+		for app := range legacyApps {
+			if app.hasServer(server) {
+				ready = app.State() == StateRunning
+				break
+			}
+		}
+		appMutex.Unlock()
+		respondReadiness(ctx, ready)
+	}
+}
+
+// ReadinessHandler returns a handler responding 200 if the app is running,
+// or 503 once it's draining, which can be used as the readiness probe.
+func (a *App) ReadinessHandler() Handler {
+	return func(ctx *Context) {
+		respondReadiness(ctx, a.State() == StateRunning)
+	}
+}
+
+func respondReadiness(ctx *Context, ready bool) {
+	if !ready {
+		ctx.Response.Status(http.StatusServiceUnavailable)
+		_ = ctx.Response.String("not ready")
+		return
+	}
+	ctx.Response.Status(http.StatusOK)
+	_ = ctx.Response.String("ready")
 }
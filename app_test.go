@@ -0,0 +1,366 @@
+package shack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func waitReady(t *testing.T, addr string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if Ready(addr) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("app on %s is not ready", addr)
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	addr := freeAddr(t)
+	r := NewRouter()
+	r.GET("/ready", ReadinessHandler())
+	r.GET("/slow", func(ctx *Context) {
+		time.Sleep(300 * time.Millisecond)
+	})
+
+	var hooks []string
+	var mutex sync.Mutex
+	record := func(hook string) {
+		mutex.Lock()
+		hooks = append(hooks, hook)
+		mutex.Unlock()
+	}
+	opt := Option{
+		DrainTimeout: 50 * time.Millisecond,
+		ShutdownHooks: []ShutdownHook{
+			{Name: "first", Fn: func(ctx context.Context) error {
+				record("first")
+				return nil
+			}},
+			{Name: "slow", Timeout: 10 * time.Millisecond, Fn: func(ctx context.Context) error {
+				record("slow")
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			}},
+		},
+	}
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- Run(addr, r, opt, Option{ShutdownFunc: func() { record("func") }})
+	}()
+	waitReady(t, addr)
+
+	resp, err := http.Get("http://" + addr + "/ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected ready, got %d", resp.StatusCode)
+	}
+
+	go func() {
+		if resp, err := http.Get("http://" + addr + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	err = Shutdown(addr)
+	if Ready(addr) {
+		t.Error("app should not be ready after shutdown")
+	}
+	var shutdownErr *ShutdownError
+	if !errors.As(err, &shutdownErr) || len(shutdownErr.Errors) != 1 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := <-runErr; !errors.As(err, &shutdownErr) || len(shutdownErr.Errors) != 2 {
+		t.Fatalf("unexpected error of Run %v", err)
+	}
+	if !errors.Is(shutdownErr.Errors[0], context.DeadlineExceeded) || !errors.Is(shutdownErr.Errors[1], context.DeadlineExceeded) {
+		t.Errorf("expected drain and hook timeouts, got %v", shutdownErr)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(hooks) != 3 || hooks[0] != "first" || hooks[1] != "slow" || hooks[2] != "func" {
+		t.Errorf("unexpected hooks %v", hooks)
+	}
+
+	if err := Shutdown("127.0.0.1:1"); err != nil {
+		t.Errorf("unknown addr should be ignored, got %v", err)
+	}
+}
+
+func TestAppDrainDelay(t *testing.T) {
+	var hookErr error
+	app := NewApp(Option{DrainDelay: 100 * time.Millisecond})
+	r := NewRouter()
+	r.GET("/ready", app.ReadinessHandler())
+	r.GET("/slow", func(ctx *Context) {
+		time.Sleep(300 * time.Millisecond)
+	})
+	app.
+		Listen("127.0.0.1:0", r).
+		OnStop(ShutdownHook{Name: "ctx", Timeout: time.Second, Fn: func(ctx context.Context) error {
+			hookErr = ctx.Err()
+			return nil
+		}})
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	addr := app.Addrs()[0].String()
+	go func() {
+		if resp, err := http.Get("http://" + addr + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	stopErr := make(chan error, 1)
+	go func() {
+		stopErr <- app.Stop(ctx)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// the listener is still open during the delay
+	resp, err := http.Get("http://" + addr + "/ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while draining, got %d", resp.StatusCode)
+	}
+
+	// the drain exceeds the ctx of Stop, and the hook still has its own
+	var shutdownErr *ShutdownError
+	if err := <-stopErr; !errors.As(err, &shutdownErr) || len(shutdownErr.Errors) != 1 ||
+		!errors.Is(shutdownErr.Errors[0], context.DeadlineExceeded) {
+		t.Errorf("expected the drain timeout, got %v", err)
+	}
+	if hookErr != nil {
+		t.Errorf("hook should get a live context, got %v", hookErr)
+	}
+}
+
+func TestShutdownError(t *testing.T) {
+	err := &ShutdownError{Errors: []error{
+		fmt.Errorf("shack: drain: %w", context.DeadlineExceeded),
+		&ParamError{Source: SourceQuery, Key: "x"},
+	}}
+	// the methods are called directly, errors.Is and As don't follow
+	// Unwrap() []error before Go 1.20
+	if !err.Is(context.DeadlineExceeded) || err.Is(io.EOF) {
+		t.Error("unexpected result of Is")
+	}
+	var paramErr *ParamError
+	if !err.As(&paramErr) || paramErr.Key != "x" {
+		t.Errorf("unexpected result of As %v", paramErr)
+	}
+	var netErr *net.OpError
+	if err.As(&netErr) {
+		t.Error("As should not match net.OpError")
+	}
+}
+
+type connKey struct{}
+
+func TestRunOption(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	var value interface{}
+	r := NewRouter()
+	r.GET("/", func(ctx *Context) {
+		value = ctx.Request.Context().Value(connKey{})
+	})
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- Run("", r, Option{
+			Listener:          ln,
+			ReadHeaderTimeout: time.Second,
+			IdleTimeout:       time.Second,
+			MaxHeaderBytes:    1 << 10,
+			ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+				return context.WithValue(ctx, connKey{}, c.RemoteAddr().String())
+			},
+		})
+	}()
+	waitReady(t, addr)
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if s, ok := value.(string); !ok || len(s) == 0 {
+		t.Errorf("expected the value of ConnContext, got %v", value)
+	}
+
+	req, _ := http.NewRequest(_GET, "http://"+addr+"/", nil)
+	req.Header.Set("X-Large", strings.Repeat("x", 64<<10))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("expected 431, got %d", resp.StatusCode)
+	}
+
+	if err := Shutdown(addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-runErr; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApp(t *testing.T) {
+	api := NewRouter()
+	api.GET("/", func(ctx *Context) {
+		_ = ctx.Response.String("api")
+	})
+	admin := NewRouter()
+	admin.GET("/", func(ctx *Context) {
+		_ = ctx.Response.String("admin")
+	})
+
+	fdListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fdListener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fdListener.Close()
+	defer f.Close()
+
+	var events []string
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	app := NewApp().
+		Listen("127.0.0.1:0", api).
+		ListenUnix(socket, admin).
+		ListenFD(f.Fd(), admin).
+		OnStart(func(ctx context.Context) error {
+			events = append(events, "start")
+			return nil
+		}).
+		OnStop(ShutdownHook{Name: "stop", Fn: func(ctx context.Context) error {
+			events = append(events, "stop")
+			return nil
+		}})
+	if app.State() != StateStarting || len(app.Addrs()) > 0 {
+		t.Fatalf("unexpected state %s before starting", app.State())
+	}
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-app.Ready():
+	default:
+		t.Fatal("app should be ready after starting")
+	}
+	if app.State() != StateRunning {
+		t.Fatalf("expected running, got %s", app.State())
+	}
+	if err := app.Start(context.Background()); err == nil {
+		t.Error("app should not be started twice")
+	}
+
+	addrs := app.Addrs()
+	get := func(client *http.Client, url, expected string) {
+		t.Helper()
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != expected {
+			t.Errorf("expected %s from %s, got %s", expected, url, body)
+		}
+	}
+	get(http.DefaultClient, "http://"+addrs[0].String()+"/", "api")
+	get(http.DefaultClient, "http://"+addrs[2].String()+"/", "admin")
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	get(unixClient, "http://unix/", "admin")
+	unixClient.CloseIdleConnections()
+
+	if !Ready(addrs[0].String()) || !Ready(socket) {
+		t.Error("app should be ready by its addrs")
+	}
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if app.State() != StateStopped || Ready(addrs[0].String()) {
+		t.Errorf("expected stopped, got %s", app.State())
+	}
+	if len(events) != 2 || events[0] != "start" || events[1] != "stop" {
+		t.Errorf("unexpected events %v", events)
+	}
+}
+
+func TestAppStartError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	app := NewApp().Listen("127.0.0.1:0", NewRouter()).Listen(ln.Addr().String(), NewRouter())
+	if err := app.Start(context.Background()); err == nil {
+		t.Fatal("expected the error of listening on a used addr")
+	}
+	if app.State() != StateStopped {
+		t.Errorf("expected stopped, got %s", app.State())
+	}
+	select {
+	case <-app.Done():
+	default:
+		t.Error("app should be done after failing to start")
+	}
+
+	hookErr := errors.New("hook")
+	app = NewApp().Listen("127.0.0.1:0", NewRouter()).OnStart(func(ctx context.Context) error {
+		return hookErr
+	})
+	if err := app.Start(context.Background()); !errors.Is(err, hookErr) {
+		t.Errorf("expected the error of start hook, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package shack
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BindError is returned by binding if any field can't be bound,
+// it lists the errors of every field.
+type BindError struct {
+	Fields []*FieldError
+}
+
+func (e *BindError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Error()
+	}
+	return "shack: bind failed: " + strings.Join(messages, "; ")
+}
+
+// FieldError describes a field which can't be bound.
+type FieldError struct {
+	// Field is the path of the struct field, like `Filter.Name`,
+	// or the key if binding to a map.
+	Field  string
+	Source string
+	Key    string
+	Value  string
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("field '%s' of %s param '%s' with value '%s' is not valid: %s",
+		e.Field, e.Source, e.Key, e.Value, e.Reason())
+}
+
+// Reason returns the short reason why the value is not valid,
+// like `invalid syntax` or `value out of range`.
+func (e *FieldError) Reason() string {
+	var numErr *strconv.NumError
+	if errors.As(e.Err, &numErr) {
+		return numErr.Err.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+type bindSource struct {
+	tag string
+	get valuesGetter
+}
+
+var (
+	// nonBodyTags are the tags of the sources other than body.
+	nonBodyTags = []string{SourcePath, SourceQuery, SourceHeader, SourceCookie}
+	// bodyTags are the tags of the builtin body decoders.
+	bodyTags = []string{"json", "xml", "yaml", SourceForm}
+	// nonBodyFieldsCache caches the index sequences of the non-body fields
+	// by reflect.Type.
+	nonBodyFieldsCache sync.Map
+)
+
+// nonBodyFieldsOf returns the index sequences of the fields of t, which
+// are only tagged with the sources other than body, like `header`.
+// The body can't be decoded to them, even by their field names.
+func nonBodyFieldsOf(t reflect.Type) [][]int {
+	if fields, ok := nonBodyFieldsCache.Load(t); ok {
+		return fields.([][]int)
+	}
+
+	var fields [][]int
+	var collect func(t reflect.Type, index []int)
+	collect = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fieldIndex := append(index[:len(index):len(index)], i)
+			if field.Anonymous && len(field.Tag) == 0 && field.Type.Kind() == reflect.Struct {
+				collect(field.Type, fieldIndex)
+				continue
+			}
+			if len(field.PkgPath) == 0 && hasTag(field, nonBodyTags) && !hasTag(field, bodyTags) {
+				fields = append(fields, fieldIndex)
+			}
+		}
+	}
+	collect(t, nil)
+
+	actual, _ := nonBodyFieldsCache.LoadOrStore(t, fields)
+	return actual.([][]int)
+}
+
+func hasTag(field reflect.StructField, tags []string) bool {
+	for _, tag := range tags {
+		if _, ok := field.Tag.Lookup(tag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Bind binds the request to the fields of dst by struct tags,
+// `path` for path params, `query` for query params, `header` for headers,
+// `cookie` for cookies.
+// The body is decoded to dst by the Decoder registered for Content-Type
+// before the others, so the fields tagged like `json`, `xml` or `form`
+// are filled from the body, and the fields only tagged with the other
+// sources are never filled from the body.
+// dst is validated by Validate after binding.
+// The error is also set to the context.
+func (c *Context) Bind(dst interface{}) error {
+	err := c.bind(dst)
+	if err == nil {
+		err = Validate(dst)
+	}
+	c.Error(err)
+	return err
+}
+
+func (c *Context) bind(dst interface{}) error {
+	p := reflect.ValueOf(dst)
+	if p.Kind() != reflect.Ptr || p.IsNil() || p.Elem().Kind() != reflect.Struct {
+		return errors.New("dst must be a pointer to struct")
+	}
+
+	var errs []*FieldError
+	if err := c.bindBody(p); err != nil {
+		bindErr, ok := err.(*BindError)
+		if !ok {
+			return err
+		}
+		errs = append(errs, bindErr.Fields...)
+	}
+
+	sources := []bindSource{
+		{SourcePath, func(key string) ([]string, bool) {
+			v, ok := c.PathParams[key]
+			return []string{v}, ok
+		}},
+		{SourceQuery, func(key string) ([]string, bool) {
+			v, ok := c.Request.queryValues()[key]
+			return v, ok
+		}},
+		{SourceHeader, func(key string) ([]string, bool) {
+			v := c.Request.Request.Header.Values(key)
+			return v, len(v) > 0
+		}},
+		{SourceCookie, func(key string) ([]string, bool) {
+			cookie, err := c.Request.Cookie(key)
+			if err != nil {
+				return nil, false
+			}
+			return []string{cookie.Value}, true
+		}},
+	}
+
+	for _, source := range sources {
+		b := &binder{source: source.tag, tag: source.tag, get: source.get}
+		b.bind(p.Elem())
+		errs = append(errs, b.errs...)
+	}
+	if len(errs) > 0 {
+		return &BindError{Fields: errs}
+	}
+	return nil
+}
+
+// bindBody decodes the body to the struct p points to by the decoder of
+// Content-Type, it responds 415 if the Content-Type is malformed or
+// there isn't a decoder for it.
+func (c *Context) bindBody(p reflect.Value) error {
+	if len(c.Request.Header("Content-Type")) == 0 {
+		return nil
+	}
+
+	decoder, ok := decoderOf(c.Request.MediaType())
+	if !ok {
+		c.Response.Status(http.StatusUnsupportedMediaType)
+		return ErrUnsupportedMediaType
+	}
+	// decode to a copy without the non-body fields, and restore them
+	// after decoding
+	nonBodyFields := nonBodyFieldsOf(p.Elem().Type())
+	dst := p
+	if len(nonBodyFields) > 0 {
+		dst = reflect.New(p.Elem().Type())
+		dst.Elem().Set(p.Elem())
+		for _, index := range nonBodyFields {
+			field := dst.Elem().FieldByIndex(index)
+			field.Set(reflect.Zero(field.Type()))
+		}
+		defer func() {
+			for _, index := range nonBodyFields {
+				dst.Elem().FieldByIndex(index).Set(p.Elem().FieldByIndex(index))
+			}
+			p.Elem().Set(dst.Elem())
+		}()
+	}
+
+	if err := decoder.Decode(&c.Request, dst.Interface()); err != nil {
+		if _, ok := err.(*BindError); ok {
+			return err
+		}
+		return &ParamError{Source: SourceBody, Err: err}
+	}
+	return nil
+}
+
+// MediaType returns the media type of Content-Type header without parameters,
+// it's empty if the header is missing or malformed.
+func (r *Request) MediaType() string {
+	contentType := r.Header("Content-Type")
+	if len(contentType) == 0 {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
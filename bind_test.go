@@ -0,0 +1,284 @@
+package shack
+
+import (
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContextBind(t *testing.T) {
+	type request struct {
+		ID     int    `path:"id"`
+		Page   int    `query:"page"`
+		Tenant string `header:"X-Tenant"`
+		Sid    string `cookie:"sid"`
+		Name   string `json:"name" form:"name"`
+		Age    int    `json:"age"`
+	}
+
+	var got request
+	r := NewRouter()
+	r.POST("/users/:id", func(ctx *Context) {
+		got = request{}
+		if err := ctx.Bind(&got); err != nil {
+			t.Error(err)
+		}
+	})
+
+	tests := []struct {
+		contentType string
+		body        string
+		expected    request
+	}{
+		{"application/json; charset=utf-8", `{"name":"foo","age":18}`, request{42, 2, "t1", "s1", "foo", 18}},
+		{"application/x-www-form-urlencoded", "name=bar&age=18", request{42, 2, "t1", "s1", "bar", 0}},
+		{"", "", request{42, 2, "t1", "s1", "", 0}},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest(_POST, "/users/42?page=2", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.contentType)
+		req.Header.Set("X-Tenant", "t1")
+		req.AddCookie(&http.Cookie{Name: "sid", Value: "s1"})
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		if got != test.expected {
+			t.Errorf("input [%d]: expecting:%+v, got:%+v", i, test.expected, got)
+		}
+	}
+}
+
+type bindTenant struct {
+	Tenant string `header:"X-Tenant"`
+}
+
+func TestContextBindBodyFields(t *testing.T) {
+	type request struct {
+		bindTenant
+		ID    int    `path:"id"`
+		Role  string `query:"role"`
+		Token string `cookie:"token"`
+		Name  string `json:"name"`
+		Page  int    `json:"page" query:"page"`
+	}
+
+	var got request
+	r := NewRouter()
+	r.POST("/users/:id", func(ctx *Context) {
+		got = request{Role: "guest"}
+		if err := ctx.Bind(&got); err != nil {
+			t.Error(err)
+		}
+	})
+
+	body := `{"name":"a","Tenant":"evil","ID":7,"Role":"admin","Token":"forged","page":3}`
+	req := httptest.NewRequest(_POST, "/users/42", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	expected := request{ID: 42, Role: "guest", Name: "a", Page: 3}
+	if got != expected {
+		t.Errorf("expecting:%+v, got:%+v", expected, got)
+	}
+}
+
+type upperText string
+
+func (u *upperText) UnmarshalText(text []byte) error {
+	*u = upperText(strings.ToUpper(string(text)))
+	return nil
+}
+
+func TestRequestBindQuery(t *testing.T) {
+	type filter struct {
+		Name string `query:"name"`
+	}
+	type query struct {
+		Q       string        `query:"q"`
+		Tags    []string      `query:"tag"`
+		IDs     []int         `query:"id"`
+		Page    *int          `query:"page"`
+		Since   time.Time     `query:"since"`
+		Timeout time.Duration `query:"timeout"`
+		Code    upperText     `query:"code"`
+		Filter  filter        `query:"filter"`
+		Sort    *filter       `query:"sort"`
+		Scope   *filter       `query:"scope"`
+		Ignored string        `query:"-"`
+	}
+
+	rawQuery := "q=a%20b%3Dc&tag=x&tag=y&tag[]=z&id=1,2&id[]=3&page=2" +
+		"&since=2021-01-02T03:04:05Z&timeout=1m30s&code=abc&filter.name=foo&sort.name=bar&Ignored=bar"
+	req := &Request{Request: httptest.NewRequest(_GET, "/?"+rawQuery, nil)}
+
+	var got query
+	if err := req.BindQuery(&got, "query"); err != nil {
+		t.Fatal(err)
+	}
+
+	page := 2
+	expected := query{
+		Q:       "a b=c",
+		Tags:    []string{"x", "y", "z"},
+		IDs:     []int{1, 2, 3},
+		Page:    &page,
+		Since:   time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		Timeout: 90 * time.Second,
+		Code:    "ABC",
+		Filter:  filter{Name: "foo"},
+		Sort:    &filter{Name: "bar"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	m := make(map[string]string)
+	if err := req.BindQuery(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m["q"] != "a b=c" || m["tag"] != "x" {
+		t.Errorf("unexpected map %v", m)
+	}
+
+}
+
+func TestRequestBindQueryError(t *testing.T) {
+	type query struct {
+		Page  int    `query:"page"`
+		Level int32  `query:"level"`
+		Size  uint8  `query:"size"`
+		IDs   []uint `query:"id"`
+		Name  string `query:"name"`
+	}
+
+	req := &Request{Request: httptest.NewRequest(_GET, "/?page=abc&level=7&size=256&id=1,-2&name=foo", nil)}
+	var got query
+	err := req.BindQuery(&got, "query")
+	bindErr, ok := err.(*BindError)
+	if !ok {
+		t.Fatalf("expected BindError, got %v", err)
+	}
+
+	expected := []FieldError{
+		{Field: "Page", Source: SourceQuery, Key: "page", Value: "abc"},
+		{Field: "Size", Source: SourceQuery, Key: "size", Value: "256"},
+		{Field: "IDs", Source: SourceQuery, Key: "id", Value: "1,-2"},
+	}
+	reasons := []string{"invalid syntax", "value out of range", "invalid syntax"}
+	if len(bindErr.Fields) != len(expected) {
+		t.Fatalf("expected %d field errors, got %v", len(expected), bindErr)
+	}
+	for i, field := range bindErr.Fields {
+		e := expected[i]
+		if field.Field != e.Field || field.Source != e.Source || field.Key != e.Key || field.Value != e.Value {
+			t.Errorf("expected %+v, got %+v", e, *field)
+		}
+		if field.Reason() != reasons[i] {
+			t.Errorf("expected reason %s, got %s", reasons[i], field.Reason())
+		}
+	}
+	if got.Level != 7 || got.Name != "foo" {
+		t.Errorf("valid fields should be bound, got %+v", got)
+	}
+}
+
+type benchQuery struct {
+	F1  string   `query:"f1"`
+	F2  string   `query:"f2"`
+	F3  string   `query:"f3"`
+	F4  string   `query:"f4"`
+	F5  string   `query:"f5"`
+	F6  int      `query:"f6"`
+	F7  int      `query:"f7"`
+	F8  int      `query:"f8"`
+	F9  int64    `query:"f9"`
+	F10 int64    `query:"f10"`
+	F11 uint     `query:"f11"`
+	F12 uint8    `query:"f12"`
+	F13 float64  `query:"f13"`
+	F14 float32  `query:"f14"`
+	F15 bool     `query:"f15"`
+	F16 bool     `query:"f16"`
+	F17 *int     `query:"f17"`
+	F18 *string  `query:"f18"`
+	F19 []int    `query:"f19"`
+	F20 []string `query:"f20"`
+}
+
+func BenchmarkBindQuery(b *testing.B) {
+	rawQuery := "f1=a&f2=b&f3=c&f4=d&f5=e&f6=1&f7=2&f8=3&f9=4&f10=5&f11=6&f12=7" +
+		"&f13=1.5&f14=2.5&f15=true&f16=false&f17=8&f18=f&f19=1,2,3&f20=x&f20=y"
+	req := &Request{Request: httptest.NewRequest(_GET, "/?"+rawQuery, nil)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var dst benchQuery
+		if err := req.BindQuery(&dst, "query"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestContextBindDecoder(t *testing.T) {
+	type request struct {
+		Name string `json:"name" yaml:"name" form:"name"`
+		Age  int    `json:"age" yaml:"age" form:"age"`
+	}
+
+	RegisterDecoder("application/x-test", DecoderFunc(func(r *Request, dst interface{}) error {
+		parts := strings.SplitN(string(r.Body()), ":", 2)
+		dst.(*request).Name = parts[0]
+		return nil
+	}))
+
+	var got request
+	var err error
+	r := NewRouter()
+	r.POST("/", func(ctx *Context) {
+		got = request{}
+		err = ctx.Bind(&got)
+	})
+
+	var multipartBody strings.Builder
+	mw := multipart.NewWriter(&multipartBody)
+	_ = mw.WriteField("name", "baz")
+	_ = mw.WriteField("age", "20")
+	_ = mw.Close()
+
+	tests := []struct {
+		contentType string
+		body        string
+		code        int
+		expected    request
+	}{
+		{"application/yaml", "name: foo\nage: 18\n", http.StatusOK, request{"foo", 18}},
+		{"application/vnd.api+json", `{"name":"bar"}`, http.StatusOK, request{"bar", 0}},
+		{mw.FormDataContentType(), multipartBody.String(), http.StatusOK, request{"baz", 20}},
+		{"application/x-test", "qux:1", http.StatusOK, request{"qux", 0}},
+		{"application/x-msgpack", "\x82\xa4name\xa3foo\xa3age\x12", http.StatusOK, request{"foo", 18}},
+		{"application/vnd.api+msgpack", "\x81\xa4name\xa3bar", http.StatusOK, request{"bar", 0}},
+		{"application/octet-stream", "foo", http.StatusUnsupportedMediaType, request{}},
+		{"json", `{"name":"foo"}`, http.StatusUnsupportedMediaType, request{}},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest(_POST, "/", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.contentType)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != test.code {
+			t.Errorf("test %d: expected code %d, got %d", i, test.code, w.Code)
+		}
+		if test.code == http.StatusOK && err != nil {
+			t.Errorf("test %d: %v", i, err)
+		}
+		if test.code == http.StatusUnsupportedMediaType && err != ErrUnsupportedMediaType {
+			t.Errorf("test %d: expected ErrUnsupportedMediaType, got %v", i, err)
+		}
+		if got != test.expected {
+			t.Errorf("test %d: expected %+v, got %+v", i, test.expected, got)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package shack
 
 import (
 	"net/http"
+	"strings"
 )
 
 const (
@@ -14,3 +15,5 @@ const (
 	_HEAD    = http.MethodHead
 	_ALL     = "ALL"
 )
+
+var allMethods = strings.Join([]string{_DELETE, _GET, _HEAD, _OPTIONS, _PATCH, _POST, _PUT}, ", ")
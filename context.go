@@ -19,19 +19,17 @@ type Context struct {
 	PathParams  map[string]string
 	handlers    []Handler
 	Err         error
-	errOnce     *sync.Once
+	errOnce     sync.Once
 	Bucket      map[string]interface{}
-	bucketMutex *sync.RWMutex
+	bucketMutex sync.RWMutex
 }
 
 func getContext(request *http.Request, response http.ResponseWriter) *Context {
 	ctx := ctxPool.Get().(*Context)
 	ctx.reset()
-	ctx.Request = Request{Request: request}
+	ctx.Request = Request{Request: request, ctx: ctx}
 	ctx.Response = Response{ResponseWriter: response}
 	ctx.index = -1
-	ctx.errOnce = &sync.Once{}
-	ctx.bucketMutex = &sync.RWMutex{}
 	return ctx
 }
 
@@ -43,9 +41,9 @@ func (c *Context) reset() {
 	c.PathParams = nil
 	c.handlers = nil
 	c.Err = nil
-	c.errOnce = nil
+	c.errOnce = sync.Once{}
 	c.Bucket = nil
-	c.bucketMutex = nil
+	c.bucketMutex = sync.RWMutex{}
 }
 
 // Set stores a key/value pair in the context bucket.
@@ -91,6 +89,12 @@ func (c *Context) Next() {
 	_ = c.Response.Flush()
 }
 
+// JSON writes data as json to the response, it's a shortcut of
+// Response.JSON.
+func (c *Context) JSON(data interface{}) error {
+	return c.Response.JSON(data)
+}
+
 // Abort prevents pending handlers from being called.
 func (c *Context) Abort() {
 	c.index = abortIndex
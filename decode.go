@@ -0,0 +1,153 @@
+package shack
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrUnsupportedMediaType is returned by binding if there isn't a decoder
+// registered for the Content-Type of request.
+var ErrUnsupportedMediaType = errors.New("shack: unsupported media type")
+
+// Decoder decodes the body of request to dst.
+type Decoder interface {
+	Decode(r *Request, dst interface{}) error
+}
+
+// DecoderFunc is an adapter to use a function as Decoder.
+type DecoderFunc func(r *Request, dst interface{}) error
+
+func (f DecoderFunc) Decode(r *Request, dst interface{}) error {
+	return f(r, dst)
+}
+
+var decoders = map[string]Decoder{
+	"application/json":                  DecoderFunc(decodeJSON),
+	"application/xml":                   DecoderFunc(decodeXML),
+	"text/xml":                          DecoderFunc(decodeXML),
+	"application/yaml":                  DecoderFunc(decodeYAML),
+	"application/x-yaml":                DecoderFunc(decodeYAML),
+	"text/yaml":                         DecoderFunc(decodeYAML),
+	"application/msgpack":               DecoderFunc(decodeMsgpack),
+	"application/x-msgpack":             DecoderFunc(decodeMsgpack),
+	"application/x-protobuf":            DecoderFunc(decodeProtobuf),
+	"application/protobuf":              DecoderFunc(decodeProtobuf),
+	"application/x-www-form-urlencoded": DecoderFunc(decodeForm),
+	"multipart/form-data":               DecoderFunc(decodeForm),
+}
+
+// RegisterDecoder registers the decoder of a media type, it replaces
+// the existing one of the same type. It should be called before serving.
+func RegisterDecoder(mime string, decoder Decoder) {
+	if len(mime) == 0 || decoder == nil {
+		panic("shack: media type and decoder can't be empty")
+	}
+	decoders[strings.ToLower(mime)] = decoder
+}
+
+// decoderOf returns the decoder of the media type, the structured syntax
+// suffixes like `+json` are decoded as their base types.
+func decoderOf(mediaType string) (Decoder, bool) {
+	if decoder, ok := decoders[mediaType]; ok {
+		return decoder, true
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		switch mediaType[i+1:] {
+		case "json":
+			return decoders["application/json"], true
+		case "xml":
+			return decoders["application/xml"], true
+		case "yaml":
+			return decoders["application/yaml"], true
+		case "msgpack":
+			return decoders["application/x-msgpack"], true
+		}
+	}
+	return nil, false
+}
+
+func decodeJSON(r *Request, dst interface{}) error {
+	body, err := r.ReadBody()
+	if err != nil || len(body) == 0 {
+		return err
+	}
+	return json.Unmarshal(body, dst)
+}
+
+func decodeXML(r *Request, dst interface{}) error {
+	body, err := r.ReadBody()
+	if err != nil || len(body) == 0 {
+		return err
+	}
+	return xml.Unmarshal(body, dst)
+}
+
+func decodeYAML(r *Request, dst interface{}) error {
+	body, err := r.ReadBody()
+	if err != nil || len(body) == 0 {
+		return err
+	}
+	return yaml.Unmarshal(body, dst)
+}
+
+// decodeMsgpack decodes the MessagePack body by the `json` tags, the same
+// as the msgpack renderer.
+func decodeMsgpack(r *Request, dst interface{}) error {
+	body, err := r.ReadBody()
+	if err != nil || len(body) == 0 {
+		return err
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(body))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(dst)
+}
+
+// decodeProtobuf decodes the protobuf body, dst must be a proto.Message.
+func decodeProtobuf(r *Request, dst interface{}) error {
+	message, ok := dst.(proto.Message)
+	if !ok {
+		return fmt.Errorf("shack: can't decode protobuf into %T", dst)
+	}
+	body, err := r.ReadBody()
+	if err != nil || len(body) == 0 {
+		return err
+	}
+	return proto.Unmarshal(body, message)
+}
+
+func decodeForm(r *Request, dst interface{}) error {
+	if err := r.parseMultipartForm(); err != nil {
+		return err
+	}
+	var files map[string][]*multipart.FileHeader
+	if r.MultipartForm != nil {
+		files = r.MultipartForm.File
+	}
+	return bindForm(r.PostForm, files, dst)
+}
+
+// bindForm binds the form values and files to the fields of dst tagged
+// with `form`.
+func bindForm(values url.Values, files map[string][]*multipart.FileHeader, dst interface{}) error {
+	p := reflect.ValueOf(dst)
+	if p.Kind() != reflect.Ptr || p.IsNil() || p.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	b := &binder{source: SourceForm, tag: SourceForm, files: files, get: func(key string) ([]string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}}
+	b.bind(p.Elem())
+	return b.err()
+}
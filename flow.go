@@ -0,0 +1,223 @@
+package shack
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ichxxx/shack/utils"
+)
+
+// Flow wraps a raw value of the request with chained conversions.
+// A conversion returns the zero value if it fails, and the error can be
+// got by Flow.Err, which is also set to the context.
+type Flow struct {
+	ctx    *Context
+	source string
+	key    string
+	raw    []byte
+	values url.Values
+	err    error
+}
+
+// ParamFlow returns a Flow of the path param.
+func (c *Context) ParamFlow(key string) *Flow {
+	return c.newFlow(SourcePath, key, utils.UnsafeBytes(c.Param(key)))
+}
+
+// QueryFlow returns a Flow of the first value of query param.
+func (c *Context) QueryFlow(key string) *Flow {
+	return c.newFlow(SourceQuery, key, utils.UnsafeBytes(c.Query(key)))
+}
+
+// RawQueryFlow returns a Flow of the raw query string.
+func (c *Context) RawQueryFlow() *Flow {
+	return c.newFlow(SourceQuery, "", utils.UnsafeBytes(c.Request.RawQuery()))
+}
+
+// FormFlow returns a Flow of the first value of form field.
+func (c *Context) FormFlow(key string) *Flow {
+	return c.newFlow(SourceForm, key, utils.UnsafeBytes(c.Form(key)))
+}
+
+// FormsFlow returns a Flow of the whole form.
+func (c *Context) FormsFlow() *Flow {
+	_ = c.Request.Forms("")
+	f := c.newFlow(SourceForm, "", nil)
+	f.values = c.Request.PostForm
+	return f
+}
+
+// HeaderFlow returns a Flow of the request header.
+func (c *Context) HeaderFlow(key string) *Flow {
+	return c.newFlow(SourceHeader, key, utils.UnsafeBytes(c.Header(key)))
+}
+
+// BodyFlow returns a Flow of the request body.
+func (c *Context) BodyFlow() *Flow {
+	return c.newFlow(SourceBody, "", c.Request.Body())
+}
+
+func (c *Context) newFlow(source, key string, raw []byte) *Flow {
+	return &Flow{ctx: c, source: source, key: key, raw: raw}
+}
+
+// Default sets the raw value to v if it's empty.
+func (f *Flow) Default(v string) *Flow {
+	if len(f.raw) == 0 && f.values == nil {
+		f.raw = utils.UnsafeBytes(v)
+	}
+	return f
+}
+
+// Err returns the first error of conversions.
+func (f *Flow) Err() error {
+	return f.err
+}
+
+func (f *Flow) String() string {
+	return string(f.raw)
+}
+
+func (f *Flow) Bytes() []byte {
+	return f.raw
+}
+
+func (f *Flow) Int() int {
+	s, ok := f.value()
+	if !ok {
+		return 0
+	}
+	i, err := strconv.Atoi(s)
+	f.error(err)
+	return i
+}
+
+func (f *Flow) Int64() int64 {
+	s, ok := f.value()
+	if !ok {
+		return 0
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	f.error(err)
+	return i
+}
+
+func (f *Flow) Uint64() uint64 {
+	s, ok := f.value()
+	if !ok {
+		return 0
+	}
+	i, err := strconv.ParseUint(s, 10, 64)
+	f.error(err)
+	return i
+}
+
+func (f *Flow) Float64() float64 {
+	s, ok := f.value()
+	if !ok {
+		return 0
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	f.error(err)
+	return v
+}
+
+func (f *Flow) Bool() bool {
+	s, ok := f.value()
+	if !ok {
+		return false
+	}
+	b, err := strconv.ParseBool(s)
+	f.error(err)
+	return b
+}
+
+// Time parses the raw value with layout.
+func (f *Flow) Time(layout string) time.Time {
+	s, ok := f.value()
+	if !ok {
+		return time.Time{}
+	}
+	t, err := time.Parse(layout, s)
+	f.error(err)
+	return t
+}
+
+func (f *Flow) Duration() time.Duration {
+	s, ok := f.value()
+	if !ok {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	f.error(err)
+	return d
+}
+
+// Split slices the raw value into all substrings separated by sep,
+// it returns nil if the raw value is empty.
+func (f *Flow) Split(sep string) []string {
+	if len(f.raw) == 0 {
+		return nil
+	}
+	return strings.Split(f.String(), sep)
+}
+
+// Bind binds the url encoded values, like the raw query or forms,
+// to the fields of dst by tag.
+func (f *Flow) Bind(dst interface{}, tag ...string) error {
+	p := reflect.ValueOf(dst)
+	if p.Kind() != reflect.Ptr || p.IsNil() {
+		return f.error(errors.New("dst must be a pointer"))
+	}
+
+	values := f.values
+	if values == nil {
+		var err error
+		if values, err = url.ParseQuery(f.String()); err != nil {
+			return f.error(err)
+		}
+	}
+	return f.error(mapTo(p.Elem(), f.source, values, tag...))
+}
+
+// BindJSON decodes the raw value as json to dst.
+func (f *Flow) BindJSON(dst interface{}) error {
+	return f.error(json.Unmarshal(f.raw, dst))
+}
+
+// BindJson is the same as BindJSON.
+//
+// Deprecated: use BindJSON.
+func (f *Flow) BindJson(dst interface{}) error {
+	return f.BindJSON(dst)
+}
+
+func (f *Flow) value() (string, bool) {
+	if len(f.raw) == 0 {
+		f.error(ErrMissingValue)
+		return "", false
+	}
+	return f.String(), true
+}
+
+func (f *Flow) error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*BindError); !ok {
+		var value string
+		if len(f.key) > 0 {
+			value = f.String()
+		}
+		err = &ParamError{Source: f.source, Key: f.key, Value: value, Err: err}
+	}
+	if f.err == nil {
+		f.err = err
+	}
+	f.ctx.Error(err)
+	return err
+}
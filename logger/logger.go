@@ -180,7 +180,7 @@ func (l *logger) Warn(msg string, keyAndValues ...interface{}) {
 }
 
 func Error(msg string, keyAndValues ...interface{}) {
-	log.Error(msg, keyAndValues)
+	log.Error(msg, keyAndValues...)
 }
 
 func (l *logger) Error(msg string, keyAndValues ...interface{}) {
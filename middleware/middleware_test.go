@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -20,8 +21,7 @@ func panicHandler(ctx *shack.Context) {
 func TestRecovery(t *testing.T) {
 	r := shack.NewRouter()
 	r.GET("/panic", panicHandler).With(Recovery())
-	go shack.Run(":8080", r)
-	request(t, "http://127.0.0.1:8080", "GET", "/panic", nil)
+	request(t, serve(t, r), "GET", "/panic", nil)
 }
 
 func TestAccessLog(t *testing.T) {
@@ -29,8 +29,20 @@ func TestAccessLog(t *testing.T) {
 	r.GET("/access", func(ctx *shack.Context) {
 		ctx.Response.String("access")
 	}).With(AccessLog())
-	go shack.Run(":8080", r)
-	request(t, "http://127.0.0.1:8080", "GET", "/access", nil)
+	request(t, serve(t, r), "GET", "/access", nil)
+}
+
+// serve runs the router on a free port until the test ends, and returns
+// the url of it.
+func serve(t *testing.T, r *shack.Router) string {
+	app := shack.NewApp().Listen("127.0.0.1:0", r)
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = app.Stop(context.Background())
+	})
+	return "http://" + app.Addrs()[0].String()
 }
 
 func request(t *testing.T, url, method, path string, body io.Reader) (*http.Response, string) {
@@ -0,0 +1,308 @@
+package shack
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/bytebufferpool"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrNotAcceptable is returned by Negotiate if none of the offers
+// is acceptable.
+var ErrNotAcceptable = errors.New("shack: not acceptable")
+
+// Renderer encodes data to w in a media type.
+type Renderer interface {
+	Render(w io.Writer, data interface{}) error
+}
+
+// RendererFunc is an adapter to use a function as Renderer.
+type RendererFunc func(w io.Writer, data interface{}) error
+
+func (f RendererFunc) Render(w io.Writer, data interface{}) error {
+	return f(w, data)
+}
+
+// RenderChecker can be implemented by the renderers which can only render
+// some kinds of data, they are offered by Negotiate by default only if
+// CanRender reports true for the data.
+type RenderChecker interface {
+	CanRender(data interface{}) bool
+}
+
+// checkedRenderer is a renderer with the check of data.
+type checkedRenderer struct {
+	RendererFunc
+	can func(data interface{}) bool
+}
+
+func (r checkedRenderer) CanRender(data interface{}) bool {
+	return r.can(data)
+}
+
+var (
+	renderers = map[string]Renderer{
+		"application/json": RendererFunc(func(w io.Writer, data interface{}) error {
+			return json.NewEncoder(w).Encode(data)
+		}),
+		"application/xml": checkedRenderer{func(w io.Writer, data interface{}) error {
+			return xml.NewEncoder(w).Encode(data)
+		}, canRenderXML},
+		"application/yaml": RendererFunc(func(w io.Writer, data interface{}) error {
+			return yaml.NewEncoder(w).Encode(data)
+		}),
+		"application/x-msgpack": RendererFunc(func(w io.Writer, data interface{}) error {
+			enc := msgpack.NewEncoder(w)
+			enc.SetCustomStructTag("json")
+			return enc.Encode(data)
+		}),
+		"application/x-protobuf": checkedRenderer{func(w io.Writer, data interface{}) error {
+			message, ok := data.(proto.Message)
+			if !ok {
+				return fmt.Errorf("shack: can't render %T as protobuf", data)
+			}
+			b, err := proto.Marshal(message)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(b)
+			return err
+		}, func(data interface{}) bool {
+			_, ok := data.(proto.Message)
+			return ok
+		}},
+		"text/plain": checkedRenderer{func(w io.Writer, data interface{}) error {
+			if b, ok := data.([]byte); ok {
+				_, err := w.Write(b)
+				return err
+			}
+			_, err := fmt.Fprint(w, data)
+			return err
+		}, canRenderText},
+		"text/csv": checkedRenderer{func(w io.Writer, data interface{}) error {
+			records, ok := data.([][]string)
+			if !ok {
+				return fmt.Errorf("shack: can't render %T as csv", data)
+			}
+			return csv.NewWriter(w).WriteAll(records)
+		}, func(data interface{}) bool {
+			_, ok := data.([][]string)
+			return ok
+		}},
+	}
+	// rendererTypes are the media types of renderers in the order they
+	// are offered by default.
+	rendererTypes = []string{
+		"application/json",
+		"application/xml",
+		"application/yaml",
+		"application/x-msgpack",
+		"application/x-protobuf",
+		"text/plain",
+		"text/csv",
+	}
+)
+
+// canRenderXML reports whether data can be encoded by encoding/xml,
+// which can't encode maps.
+func canRenderXML(data interface{}) bool {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	return v.IsValid() && v.Kind() != reflect.Map
+}
+
+// canRenderText reports whether data is a text, a number or a boolean,
+// which is meaningful as plain text.
+func canRenderText(data interface{}) bool {
+	switch data.(type) {
+	case string, []byte, fmt.Stringer, error:
+		return true
+	}
+	switch reflect.ValueOf(data).Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	}
+	return false
+}
+
+// RegisterRenderer registers the renderer of a media type, it replaces
+// the existing one of the same type. It should be called before serving.
+func RegisterRenderer(mime string, renderer Renderer) {
+	if len(mime) == 0 || renderer == nil {
+		panic("shack: media type and renderer can't be empty")
+	}
+	if _, ok := renderers[mime]; !ok {
+		rendererTypes = append(rendererTypes, mime)
+	}
+	renderers[mime] = renderer
+}
+
+// Negotiate renders data in the offer which is the most acceptable by
+// the Accept header, the offers are the registered media types which
+// can render data if none is given, and the former offer is preferred
+// if they are equally acceptable.
+// It responds 406 and returns ErrNotAcceptable if none of the offers
+// is acceptable, or 500 if data can't be rendered.
+// The error is also set to the context.
+func (c *Context) Negotiate(data interface{}, offers ...string) error {
+	if len(offers) == 0 {
+		offers = defaultOffers(data)
+	}
+	c.Response.addVary("Accept")
+
+	mime := negotiate(c.Request.Header("Accept"), offers)
+	if len(mime) == 0 {
+		c.Response.Status(http.StatusNotAcceptable)
+		c.Error(ErrNotAcceptable)
+		return ErrNotAcceptable
+	}
+
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+	renderer, ok := renderers[mime]
+	if !ok {
+		return c.renderError(fmt.Errorf("shack: renderer of '%s' is not registered", mime))
+	}
+	if err := renderer.Render(buf, data); err != nil {
+		return c.renderError(err)
+	}
+	c.Response.Header("Content-Type", mime)
+	return c.Response.Write(buf.B)
+}
+
+func (c *Context) renderError(err error) error {
+	c.Response.Status(http.StatusInternalServerError)
+	c.Error(err)
+	return err
+}
+
+// defaultOffers returns the registered media types which can render data.
+func defaultOffers(data interface{}) []string {
+	offers := make([]string, 0, len(rendererTypes))
+	for _, mime := range rendererTypes {
+		if checker, ok := renderers[mime].(RenderChecker); ok && !checker.CanRender(data) {
+			continue
+		}
+		offers = append(offers, mime)
+	}
+	return offers
+}
+
+// addVary adds the header name to Vary header if it's not there.
+func (r *Response) addVary(name string) {
+	header := r.ResponseWriter.Header()
+	if !headerContainsToken(header, "Vary", name) {
+		header.Add("Vary", name)
+	}
+}
+
+type acceptRange struct {
+	mime string
+	q    float64
+}
+
+// negotiate returns the most acceptable offer by accept, or an empty
+// string if none is acceptable.
+func negotiate(accept string, offers []string) string {
+	if len(strings.TrimSpace(accept)) == 0 {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		r := acceptRange{mime: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		if len(r.mime) == 0 {
+			continue
+		}
+		valid := true
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			r.q, valid = parseQuality(param[2:])
+		}
+		// the range with an invalid q-value is dropped, so it can't
+		// outrank the others
+		if valid {
+			ranges = append(ranges, r)
+		}
+	}
+	return ranges
+}
+
+// parseQuality parses a q-value, which is between 0 and 1 with at most
+// 3 decimals, like `0.8` or `1.000`.
+func parseQuality(s string) (float64, bool) {
+	if len(s) == 0 || len(s) > 5 || (s[0] != '0' && s[0] != '1') {
+		return 0, false
+	}
+	if len(s) > 1 {
+		if s[1] != '.' {
+			return 0, false
+		}
+		for _, c := range s[2:] {
+			if c < '0' || c > '9' || (s[0] == '1' && c != '0') {
+				return 0, false
+			}
+		}
+	}
+	q, err := strconv.ParseFloat(s, 64)
+	return q, err == nil
+}
+
+// acceptQuality returns the q-value of the most specific range matching
+// the offer, or 0 if no range matches.
+func acceptQuality(ranges []acceptRange, offer string) float64 {
+	offer = strings.ToLower(offer)
+	offerType := offer
+	if i := strings.IndexByte(offer, '/'); i >= 0 {
+		offerType = offer[:i]
+	}
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.mime == offer:
+			s = 2
+		case r.mime == offerType+"/*":
+			s = 1
+		case r.mime == "*/*" || r.mime == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
@@ -0,0 +1,104 @@
+package shack
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestNegotiate(t *testing.T) {
+	RegisterRenderer("application/x-test", RendererFunc(func(w io.Writer, data interface{}) error {
+		_, err := fmt.Fprintf(w, "test:%v", data)
+		return err
+	}))
+
+	r := NewRouter()
+	r.GET("/", func(ctx *Context) {
+		_ = ctx.Negotiate(struct {
+			XMLName struct{} `json:"-" xml:"data" yaml:"-"`
+			Foo     string   `json:"foo" xml:"foo" yaml:"foo"`
+		}{Foo: "bar"})
+	})
+	r.GET("/map", func(ctx *Context) {
+		_ = ctx.Negotiate(Map{"foo": "bar"})
+	})
+	r.GET("/csv", func(ctx *Context) {
+		if err := ctx.Negotiate(Map{"foo": "bar"}, "text/csv"); err == nil || ctx.Err != err {
+			t.Errorf("expected the render error set to context, got %v", err)
+		}
+	})
+	r.GET("/proto", func(ctx *Context) {
+		_ = ctx.Negotiate(wrapperspb.String("foo"))
+	})
+	r.GET("/text", func(ctx *Context) {
+		_ = ctx.Negotiate("foo", "text/plain", "application/x-test")
+	})
+
+	tests := []struct {
+		path        string
+		accept      string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/", "", http.StatusOK, "application/json", `{"foo":"bar"}` + "\n"},
+		{"/", "application/xml;q=0.5, application/yaml", http.StatusOK, "application/yaml", "foo: bar\n"},
+		{"/", "text/*;q=0.5, application/json;q=0.1", http.StatusOK, "application/json", `{"foo":"bar"}` + "\n"},
+		{"/map", "text/csv", http.StatusNotAcceptable, "", ""},
+		{"/map", "application/xml, text/plain", http.StatusNotAcceptable, "", ""},
+		{"/map", "application/x-msgpack", http.StatusOK, "application/x-msgpack", "\x81\xa3foo\xa3bar"},
+		{"/csv", "text/csv", http.StatusInternalServerError, "", ""},
+		{"/proto", "application/x-protobuf", http.StatusOK, "application/x-protobuf", "\n\x03foo"},
+		{"/proto", "", http.StatusOK, "application/json", `{"value":"foo"}` + "\n"},
+		{"/", "application/*, application/json;q=0", http.StatusOK, "application/xml", "<data><foo>bar</foo></data>"},
+		{"/", "image/png", http.StatusNotAcceptable, "", ""},
+		{"/text", "*/*", http.StatusOK, "text/plain", "foo"},
+		{"/text", "application/x-test, text/plain;q=0.9", http.StatusOK, "application/x-test", "test:foo"},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest(_GET, test.path, nil)
+		req.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != test.code {
+			t.Errorf("test %d: expected code %d, got %d", i, test.code, w.Code)
+		}
+		if w.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("test %d: expected content type %s, got %s", i, test.contentType, w.Header().Get("Content-Type"))
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("test %d: expected Vary: Accept, got %s", i, w.Header().Get("Vary"))
+		}
+		if len(test.body) > 0 && w.Body.String() != test.body {
+			t.Errorf("test %d: expected body %q, got %q", i, test.body, w.Body.String())
+		}
+	}
+}
+
+func TestNegotiatePreference(t *testing.T) {
+	offers := []string{"application/json", "text/html"}
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"text/html, application/json", "application/json"},
+		{"text/html, application/json;q=0.8", "text/html"},
+		{"TEXT/HTML", "text/html"},
+		{"*/*;q=0.1, text/*", "text/html"},
+		{"application/xml", ""},
+		{"text/html;q=5, application/json;q=0.9", "application/json"},
+		{"text/html;q=-1, application/json;q=0.1", "application/json"},
+		{"text/html;q=0.5555, application/json;q=0.5", "application/json"},
+		{"text/html;q=1.000, application/json;q=0.999", "text/html"},
+	}
+	for _, test := range tests {
+		if got := negotiate(test.accept, offers); got != test.expected {
+			t.Errorf("accept %s: expected %s, got %s", test.accept, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package shack
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Sources of request values.
+const (
+	SourcePath   = "path"
+	SourceQuery  = "query"
+	SourceForm   = "form"
+	SourceHeader = "header"
+	SourceCookie = "cookie"
+	SourceBody   = "body"
+)
+
+// ErrMissingValue means the value of key is not in the request.
+var ErrMissingValue = errors.New("value is missing")
+
+// ParamError is returned when a request value can't be parsed.
+type ParamError struct {
+	Source string
+	Key    string
+	Value  string
+	Err    error
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("shack: %s param '%s' with value '%s' is not valid: %v", e.Source, e.Key, e.Value, e.Err)
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// Param returns the value of path param.
+func (c *Context) Param(key string) string {
+	return c.PathParams[key]
+}
+
+// ParamOr returns the value of path param, or defaultValue if it's empty.
+func (c *Context) ParamOr(key, defaultValue string) string {
+	return or(c.Param(key), defaultValue)
+}
+
+// ParamInt parses the path param as int, the error is also set to the context.
+func (c *Context) ParamInt(key string) (int, error) {
+	i, err := c.parseInt(SourcePath, key, c.Param(key), 0)
+	return int(i), err
+}
+
+// ParamInt64 parses the path param as int64, the error is also set to the context.
+func (c *Context) ParamInt64(key string) (int64, error) {
+	return c.parseInt(SourcePath, key, c.Param(key), 64)
+}
+
+// ParamUUID returns the path param if it's a valid uuid, the error is also
+// set to the context.
+func (c *Context) ParamUUID(key string) (string, error) {
+	return c.parseUUID(SourcePath, key, c.Param(key))
+}
+
+// Query returns the first value of query param.
+func (c *Context) Query(key string, defaultValue ...string) string {
+	return c.Request.Query(key, defaultValue...)
+}
+
+// QueryOr returns the first value of query param, or defaultValue if it's empty.
+func (c *Context) QueryOr(key, defaultValue string) string {
+	return or(c.Query(key), defaultValue)
+}
+
+// QueryInt parses the query param as int, the error is also set to the context.
+func (c *Context) QueryInt(key string) (int, error) {
+	i, err := c.parseInt(SourceQuery, key, c.Query(key), 0)
+	return int(i), err
+}
+
+// QueryInt64 parses the query param as int64, the error is also set to the context.
+func (c *Context) QueryInt64(key string) (int64, error) {
+	return c.parseInt(SourceQuery, key, c.Query(key), 64)
+}
+
+// QueryUUID returns the query param if it's a valid uuid, the error is also
+// set to the context.
+func (c *Context) QueryUUID(key string) (string, error) {
+	return c.parseUUID(SourceQuery, key, c.Query(key))
+}
+
+// Form returns the first value of form field.
+func (c *Context) Form(key string) string {
+	return c.Request.Forms(key)
+}
+
+// FormOr returns the first value of form field, or defaultValue if it's empty.
+func (c *Context) FormOr(key, defaultValue string) string {
+	return or(c.Form(key), defaultValue)
+}
+
+// FormInt parses the form field as int, the error is also set to the context.
+func (c *Context) FormInt(key string) (int, error) {
+	i, err := c.parseInt(SourceForm, key, c.Form(key), 0)
+	return int(i), err
+}
+
+// FormInt64 parses the form field as int64, the error is also set to the context.
+func (c *Context) FormInt64(key string) (int64, error) {
+	return c.parseInt(SourceForm, key, c.Form(key), 64)
+}
+
+// FormUUID returns the form field if it's a valid uuid, the error is also
+// set to the context.
+func (c *Context) FormUUID(key string) (string, error) {
+	return c.parseUUID(SourceForm, key, c.Form(key))
+}
+
+// Header returns the first value of request header.
+func (c *Context) Header(key string) string {
+	return c.Request.Header(key)
+}
+
+// HeaderOr returns the first value of request header, or defaultValue if it's empty.
+func (c *Context) HeaderOr(key, defaultValue string) string {
+	return or(c.Header(key), defaultValue)
+}
+
+// HeaderInt parses the request header as int, the error is also set to the context.
+func (c *Context) HeaderInt(key string) (int, error) {
+	i, err := c.parseInt(SourceHeader, key, c.Header(key), 0)
+	return int(i), err
+}
+
+// HeaderInt64 parses the request header as int64, the error is also set to the context.
+func (c *Context) HeaderInt64(key string) (int64, error) {
+	return c.parseInt(SourceHeader, key, c.Header(key), 64)
+}
+
+// HeaderUUID returns the request header if it's a valid uuid, the error is also
+// set to the context.
+func (c *Context) HeaderUUID(key string) (string, error) {
+	return c.parseUUID(SourceHeader, key, c.Header(key))
+}
+
+func (c *Context) parseInt(source, key, value string, bitSize int) (int64, error) {
+	if len(value) == 0 {
+		return 0, c.paramError(source, key, value, ErrMissingValue)
+	}
+	i, err := strconv.ParseInt(value, 10, bitSize)
+	if err != nil {
+		return 0, c.paramError(source, key, value, err)
+	}
+	return i, nil
+}
+
+func (c *Context) parseUUID(source, key, value string) (string, error) {
+	if len(value) == 0 {
+		return "", c.paramError(source, key, value, ErrMissingValue)
+	}
+	if !uuidReg.MatchString(value) {
+		return "", c.paramError(source, key, value, errors.New("invalid uuid"))
+	}
+	return value, nil
+}
+
+func (c *Context) paramError(source, key, value string, err error) error {
+	err = &ParamError{Source: source, Key: key, Value: value, Err: err}
+	c.Error(err)
+	return err
+}
+
+func or(value, defaultValue string) string {
+	if len(value) == 0 {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,94 @@
+package shack
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContextParams(t *testing.T) {
+	r := NewRouter()
+	r.GET("/users/:id/:uuid", func(ctx *Context) {
+		if id, err := ctx.ParamInt("id"); id != 42 || err != nil {
+			t.Errorf("expecting id:42, got:%d %v", id, err)
+		}
+		if id, err := ctx.ParamUUID("uuid"); err != nil {
+			t.Errorf("expecting valid uuid, got:%s %v", id, err)
+		}
+		if page, err := ctx.QueryInt64("page"); page != 3 || err != nil {
+			t.Errorf("expecting page:3, got:%d %v", page, err)
+		}
+		if sort := ctx.QueryOr("sort", "id"); sort != "id" {
+			t.Errorf("expecting sort:id, got:%s", sort)
+		}
+		if tenant, err := ctx.HeaderInt("X-Tenant"); tenant != 7 || err != nil {
+			t.Errorf("expecting tenant:7, got:%d %v", tenant, err)
+		}
+		if ctx.Err != nil {
+			t.Errorf("expecting no error, got:%v", ctx.Err)
+		}
+
+		_, err := ctx.QueryInt("size")
+		if !errors.Is(err, ErrMissingValue) {
+			t.Errorf("expecting missing value, got:%v", err)
+		}
+		_, _ = ctx.ParamUUID("id")
+		var paramErr *ParamError
+		if !errors.As(ctx.Err, &paramErr) || paramErr.Source != SourceQuery || paramErr.Key != "size" {
+			t.Errorf("expecting the first error in context, got:%v", ctx.Err)
+		}
+	})
+
+	req := httptest.NewRequest(_GET, "/users/42/0b0f1a6e-1d3c-4c4b-9a57-3c1f2e9d8a10?page=3", nil)
+	req.Header.Set("X-Tenant", "7")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestContextFlow(t *testing.T) {
+	type query struct {
+		Foo int    `json:"foo"`
+		Bar string `json:"bar"`
+	}
+
+	r := NewRouter()
+	r.POST("/flow", func(ctx *Context) {
+		if foo := ctx.QueryFlow("foo").Int(); foo != 1 {
+			t.Errorf("expecting foo:1, got:%d", foo)
+		}
+		if tags := ctx.QueryFlow("tags").Split(","); !reflect.DeepEqual(tags, []string{"a", "b"}) {
+			t.Errorf("expecting tags:[a b], got:%v", tags)
+		}
+		if size := ctx.QueryFlow("size").Default("10").Int(); size != 10 {
+			t.Errorf("expecting size:10, got:%d", size)
+		}
+		if since := ctx.QueryFlow("since").Time("2006-01-02"); since.Day() != 2 {
+			t.Errorf("expecting since day:2, got:%v", since)
+		}
+
+		q := &query{}
+		if err := ctx.RawQueryFlow().Bind(q, "json"); err != nil || q.Foo != 1 || q.Bar != "a b" {
+			t.Errorf("unexpected query:%v %v", q, err)
+		}
+		body := &query{}
+		if err := ctx.BodyFlow().BindJSON(body); err != nil || body.Foo != 2 {
+			t.Errorf("unexpected body:%v %v", body, err)
+		}
+		legacy := &query{}
+		if err := ctx.BodyFlow().BindJson(legacy); err != nil || legacy.Foo != 2 {
+			t.Errorf("unexpected body of BindJson:%v %v", legacy, err)
+		}
+		if ctx.Err != nil {
+			t.Errorf("expecting no error, got:%v", ctx.Err)
+		}
+
+		f := ctx.QueryFlow("bar")
+		if f.Bool() || f.Err() == nil || ctx.Err == nil {
+			t.Error("expecting error of parsing bool")
+		}
+	})
+
+	req := httptest.NewRequest(_POST, "/flow?foo=1&bar=a%20b&tags=a,b&since=2022-01-02", strings.NewReader(`{"foo":2}`))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -1,181 +1,395 @@
 package shack
 
 import (
+	"encoding"
 	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-func mapTo(rv reflect.Value, m map[string]string, tag ...string) error {
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+
+	// structFieldsCache caches the []*structField by structKey.
+	structFieldsCache sync.Map
+	// settersCache caches the setter by reflect.Type.
+	settersCache sync.Map
+)
+
+// valuesGetter returns the values of key from a source of request.
+type valuesGetter func(key string) ([]string, bool)
+
+// setter sets rv to the values, which are parsed to the type of rv,
+// only the first value is used if rv isn't a slice.
+type setter func(rv reflect.Value, values []string) error
+
+func mapTo(rv reflect.Value, source string, values url.Values, tag ...string) error {
 	if rv.Kind() != reflect.Struct && rv.IsNil() {
 		return errors.New("dst is nil")
 	}
 
+	get := func(key string) ([]string, bool) {
+		v, ok := values[key]
+		return v, ok
+	}
 	switch rv.Kind() {
 	case reflect.Map:
-		kType := rv.Type().Key().Kind()
-		vType := rv.Type().Elem().Kind()
-		for k, v := range m {
-			rv.SetMapIndex(toValue(k, kType), toValue(v, vType))
-		}
-	case reflect.Struct:
-		for k, v := range m {
+		b := &binder{source: source, get: get}
+		kType := rv.Type().Key()
+		vType := rv.Type().Elem()
+		setKey, setElem := setterOf(kType), setterOf(vType)
+		for k, v := range values {
 			if len(v) == 0 {
 				continue
 			}
+			key := reflect.New(kType).Elem()
+			value := reflect.New(vType).Elem()
+			if !b.set(setKey, key, k, k, []string{k}) || !b.set(setElem, value, k, k, v) {
+				continue
+			}
+			rv.SetMapIndex(key, value)
+		}
+		return b.err()
+	case reflect.Struct:
+		b := &binder{source: source, nameAsKey: true, get: get}
+		if len(tag) > 0 {
+			b.tag = tag[0]
+		}
+		b.bind(rv)
+		return b.err()
+	}
+
+	return nil
+}
+
+// binder binds the values of a source to the fields of struct by tag,
+// the field name is used as key for the untagged fields if nameAsKey
+// is true. The errors of fields are collected rather than stopping at
+// the first one.
+type binder struct {
+	source    string
+	tag       string
+	nameAsKey bool
+	get       valuesGetter
+	// files are set to the *multipart.FileHeader and
+	// []*multipart.FileHeader fields.
+	files map[string][]*multipart.FileHeader
+	errs  []*FieldError
+}
 
-			t := rv.Type()
-			size := rv.NumField()
-			if size == 0 {
-				return errors.New("dst struct doesn't have any fields")
+// bind sets the fields of rv by the cached fields of its type.
+func (b *binder) bind(rv reflect.Value) {
+	for _, field := range structFieldsOf(rv.Type(), b.tag, b.nameAsKey) {
+		if field.file {
+			if files := b.files[field.key]; len(files) > 0 {
+				setFiles(fieldByIndex(rv, field.index), files)
 			}
+			continue
+		}
 
-		fieldLoop:
-			for i := 0; i < size; i++ {
-				field := t.Field(i)
-				if field.Type.Kind() == reflect.Struct {
-					err := mapTo(reflect.ValueOf(field.Type), m, tag...)
-					if err != nil {
-						return err
-					}
-				}
+		values := lookupValues(b.get, field.key, field.slice)
+		if len(values) == 0 {
+			continue
+		}
+		b.set(field.set, fieldByIndex(rv, field.index), field.name, field.key, values)
+	}
+}
 
-				var _tag string
-				if len(tag) > 0 {
-					_tag = tag[0]
-				}
-				key := field.Tag.Get(_tag)
-				if len(key) == 0 {
-					key = field.Name
+// fieldByIndex is like FieldByIndex, but it allocates the nil pointers
+// to nested structs along the index, so they're only allocated if any
+// of their keys is present.
+func fieldByIndex(rv reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 {
+			for rv.Kind() == reflect.Ptr {
+				if rv.IsNil() {
+					rv.Set(reflect.New(rv.Type().Elem()))
 				}
+				rv = rv.Elem()
+			}
+		}
+		rv = rv.Field(x)
+	}
+	return rv
+}
 
-				if key == "-" {
-					continue fieldLoop
-				}
+// set sets rv to the values, it records the error and returns false
+// if they can't be parsed.
+func (b *binder) set(set setter, rv reflect.Value, field, key string, values []string) bool {
+	err := set(rv, values)
+	if err == nil {
+		return true
+	}
+	b.errs = append(b.errs, &FieldError{
+		Field:  field,
+		Source: b.source,
+		Key:    key,
+		Value:  strings.Join(values, ","),
+		Err:    err,
+	})
+	return false
+}
+
+func (b *binder) err() error {
+	if len(b.errs) == 0 {
+		return nil
+	}
+	return &BindError{Fields: b.errs}
+}
+
+type structKey struct {
+	t         reflect.Type
+	tag       string
+	nameAsKey bool
+}
+
+// structField is the binding metadata of a field, which is built once
+// for each type and tag.
+type structField struct {
+	index []int  // index is the index sequence for FieldByIndex
+	name  string // name is the path of field, like `Filter.Name`
+	key   string // key is the full key of field, like `filter.name`
+	slice bool
+	file  bool
+	set   setter
+}
 
-				key = strings.Split(key, ",")[0]
-				if key == k {
-					rvField := rv.Field(i)
-					if rvField.Kind() == reflect.Ptr {
-						rvField.Set(toValuePtr(v, rvField.Type().Elem().Kind()))
-					} else {
-						rvField.Set(toValue(v, rvField.Kind()))
-					}
+// structFieldsOf returns the fields of t to bind, fields of embedded
+// structs are flattened, and fields of nested structs are keyed like
+// `filter.name`.
+func structFieldsOf(t reflect.Type, tag string, nameAsKey bool) []*structField {
+	k := structKey{t, tag, nameAsKey}
+	if fields, ok := structFieldsCache.Load(k); ok {
+		return fields.([]*structField)
+	}
+
+	var fields []*structField
+	// visiting are the structs being collected, the pointers back to them
+	// are bound as plain fields rather than collected endlessly.
+	visiting := map[reflect.Type]bool{t: true}
+	var collect func(t reflect.Type, index []int, prefix, namePrefix string)
+	collect = func(t reflect.Type, index []int, prefix, namePrefix string) {
+		walkStruct(t, tag, index, func(field reflect.StructField, key string, index []int) {
+			if len(key) == 0 {
+				if !nameAsKey {
+					return
 				}
+				key = field.Name
+			}
+
+			if nested := elemType(field.Type); isNestedStruct(nested) && !isFileType(field.Type) && !visiting[nested] {
+				visiting[nested] = true
+				collect(nested, index, prefix+key+".", namePrefix+field.Name+".")
+				delete(visiting, nested)
+				return
+			}
+			f := &structField{
+				index: index,
+				name:  namePrefix + field.Name,
+				key:   prefix + key,
+				slice: isSlice(field.Type),
+				file:  isFileType(field.Type),
+			}
+			if !f.file {
+				f.set = setterOf(field.Type)
+			}
+			fields = append(fields, f)
+		})
+	}
+	collect(t, nil, "", "")
+
+	actual, _ := structFieldsCache.LoadOrStore(k, fields)
+	return actual.([]*structField)
+}
+
+// walkStruct calls fn for each exported field of t with its key in tag
+// and index sequence, fields tagged with `-` are skipped, and fields of
+// the embedded structs without key are walked as the fields of t.
+func walkStruct(t reflect.Type, tag string, index []int, fn func(field reflect.StructField, key string, index []int)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get(tag)
+		if key == "-" {
+			continue
+		}
+
+		fieldIndex := make([]int, len(index)+1)
+		copy(fieldIndex, index)
+		fieldIndex[len(index)] = i
+
+		key = strings.Split(key, ",")[0]
+		if len(key) == 0 && field.Anonymous && isNestedStruct(field.Type) {
+			walkStruct(field.Type, tag, fieldIndex, fn)
+			continue
+		}
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+		fn(field, key, fieldIndex)
+	}
+}
+
+// lookupValues returns the non-empty values of key, and the values of
+// `key[]` and the comma-separated values are also included for slices.
+func lookupValues(get valuesGetter, key string, slice bool) []string {
+	values, _ := get(key)
+	if !slice {
+		if len(values) == 0 || len(values[0]) == 0 {
+			return nil
+		}
+		return values[:1]
+	}
+
+	if more, ok := get(key + "[]"); ok {
+		values = append(values[:len(values):len(values)], more...)
+	}
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if len(v) > 0 {
+				result = append(result, v)
 			}
 		}
 	}
+	return result
+}
 
-	return nil
+// setterOf returns the cached setter of t.
+func setterOf(t reflect.Type) setter {
+	if set, ok := settersCache.Load(t); ok {
+		return set.(setter)
+	}
+	set, _ := settersCache.LoadOrStore(t, newSetter(t))
+	return set.(setter)
 }
 
-func toValue(src string, dType reflect.Kind) reflect.Value {
-	switch dType {
+func newSetter(t reflect.Type) setter {
+	if t.Kind() == reflect.Ptr {
+		elemSet := setterOf(t.Elem())
+		return func(rv reflect.Value, values []string) error {
+			if rv.IsNil() {
+				rv.Set(reflect.New(t.Elem()))
+			}
+			return elemSet(rv.Elem(), values)
+		}
+	}
+
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return func(rv reflect.Value, values []string) error {
+			return rv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(values[0]))
+		}
+	}
+	if t == durationType {
+		return func(rv reflect.Value, values []string) error {
+			d, err := time.ParseDuration(values[0])
+			if err != nil {
+				return err
+			}
+			rv.SetInt(int64(d))
+			return nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return func(rv reflect.Value, values []string) error {
+				rv.SetBytes([]byte(values[0]))
+				return nil
+			}
+		}
+		elemSet := setterOf(t.Elem())
+		return func(rv reflect.Value, values []string) error {
+			slice := reflect.MakeSlice(t, len(values), len(values))
+			for i, value := range values {
+				if err := elemSet(slice.Index(i), []string{value}); err != nil {
+					return err
+				}
+			}
+			rv.Set(slice)
+			return nil
+		}
 	case reflect.Bool:
-		b, _ := strconv.ParseBool(src)
-		return reflect.ValueOf(b)
-	case reflect.Int:
-		i, _ := strconv.Atoi(src)
-		return reflect.ValueOf(i)
-	case reflect.Int8:
-		i, _ := strconv.Atoi(src)
-		return reflect.ValueOf(int8(i))
-	case reflect.Int16:
-		i, _ := strconv.Atoi(src)
-		return reflect.ValueOf(int16(i))
-	case reflect.Int32:
-		i, _ := strconv.Atoi(src)
-		return reflect.ValueOf(int32(i))
-	case reflect.Int64:
-		i, _ := strconv.Atoi(src)
-		return reflect.ValueOf(int64(i))
-	case reflect.Uint:
-		i, _ := strconv.Atoi(src)
-		return reflect.ValueOf(uint(i))
-	case reflect.Uint8:
-		i, _ := strconv.Atoi(src)
-		return reflect.ValueOf(uint8(i))
-	case reflect.Uint16:
-		i, _ := strconv.Atoi(src)
-		return reflect.ValueOf(uint16(i))
-	case reflect.Uint32:
-		i, _ := strconv.Atoi(src)
-		return reflect.ValueOf(uint32(i))
-	case reflect.Uint64:
-		i, _ := strconv.Atoi(src)
-		return reflect.ValueOf(uint64(i))
-	case reflect.Float32:
-		f, _ := strconv.ParseFloat(src, 32)
-		return reflect.ValueOf(float32(f))
-	case reflect.Float64:
-		f, _ := strconv.ParseFloat(src, 64)
-		return reflect.ValueOf(f)
+		return func(rv reflect.Value, values []string) error {
+			b, err := strconv.ParseBool(values[0])
+			if err != nil {
+				return err
+			}
+			rv.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// parse by the size of t, so out of range values are rejected
+		// rather than wrapped.
+		bits := t.Bits()
+		return func(rv reflect.Value, values []string) error {
+			i, err := strconv.ParseInt(values[0], 10, bits)
+			if err != nil {
+				return err
+			}
+			rv.SetInt(i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		bits := t.Bits()
+		return func(rv reflect.Value, values []string) error {
+			i, err := strconv.ParseUint(values[0], 10, bits)
+			if err != nil {
+				return err
+			}
+			rv.SetUint(i)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		bits := t.Bits()
+		return func(rv reflect.Value, values []string) error {
+			f, err := strconv.ParseFloat(values[0], bits)
+			if err != nil {
+				return err
+			}
+			rv.SetFloat(f)
+			return nil
+		}
+	case reflect.String:
+		return func(rv reflect.Value, values []string) error {
+			rv.SetString(values[0])
+			return nil
+		}
 	case reflect.Interface:
-		var i interface{} = src
-		return reflect.ValueOf(i)
+		if t.NumMethod() == 0 {
+			return func(rv reflect.Value, values []string) error {
+				rv.Set(reflect.ValueOf(values[0]))
+				return nil
+			}
+		}
+	}
 
+	return func(rv reflect.Value, values []string) error {
+		return fmt.Errorf("unsupported type %s", t)
 	}
+}
 
-	return reflect.ValueOf(src)
+func isNestedStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(textUnmarshalerType)
 }
 
-func toValuePtr(src string, dstKind reflect.Kind) reflect.Value {
-	switch dstKind {
-	case reflect.Bool:
-		b, _ := strconv.ParseBool(src)
-		return reflect.ValueOf(&b)
-	case reflect.Int:
-		i, _ := strconv.Atoi(src)
-		return reflect.ValueOf(&i)
-	case reflect.Int8:
-		i, _ := strconv.Atoi(src)
-		i8 := int8(i)
-		return reflect.ValueOf(&i8)
-	case reflect.Int16:
-		i, _ := strconv.Atoi(src)
-		i16 := int16(i)
-		return reflect.ValueOf(&i16)
-	case reflect.Int32:
-		i, _ := strconv.Atoi(src)
-		i32 := int8(i)
-		return reflect.ValueOf(&i32)
-	case reflect.Int64:
-		i, _ := strconv.Atoi(src)
-		i64 := int64(i)
-		return reflect.ValueOf(&i64)
-	case reflect.Uint:
-		i, _ := strconv.Atoi(src)
-		ui := uint(i)
-		return reflect.ValueOf(&ui)
-	case reflect.Uint8:
-		i, _ := strconv.Atoi(src)
-		ui8 := uint8(i)
-		return reflect.ValueOf(&ui8)
-	case reflect.Uint16:
-		i, _ := strconv.Atoi(src)
-		ui16 := uint16(i)
-		return reflect.ValueOf(&ui16)
-	case reflect.Uint32:
-		i, _ := strconv.Atoi(src)
-		ui32 := uint32(i)
-		return reflect.ValueOf(&ui32)
-	case reflect.Uint64:
-		i, _ := strconv.Atoi(src)
-		ui64 := uint64(i)
-		return reflect.ValueOf(&ui64)
-	case reflect.Float32:
-		f, _ := strconv.ParseFloat(src, 32)
-		f32 := float32(f)
-		return reflect.ValueOf(&f32)
-	case reflect.Float64:
-		f, _ := strconv.ParseFloat(src, 64)
-		f64 := float64(f)
-		return reflect.ValueOf(&f64)
-	case reflect.Interface:
-		var i interface{} = src
-		return reflect.ValueOf(&i)
+// elemType returns the type t points to, or t if it isn't a pointer.
+func elemType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
 	}
+	return t
+}
 
-	return reflect.ValueOf(&src)
+func isSlice(t reflect.Type) bool {
+	t = elemType(t)
+	return t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8
 }
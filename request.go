@@ -1,21 +1,31 @@
 package shack
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"reflect"
-	"strings"
 
 	"github.com/tidwall/gjson"
 )
 
+// ErrBodyTooLarge is returned when reading the request body exceeding
+// the limit set by Router.BodyLimit or Route.BodyLimit.
+var ErrBodyTooLarge = errors.New("shack: request body too large")
+
 type Request struct {
 	*http.Request
-	body  []byte
-	query url.Values
+	ctx     *Context
+	body    []byte
+	bodyErr error
+	query   url.Values
+	// rawBody is the body before limited, and limited is the body
+	// limited by http.MaxBytesReader.
+	rawBody io.ReadCloser
+	limited *limitedBody
 }
 
 func (r *Request) Header(key string) string {
@@ -39,45 +49,66 @@ func (r *Request) RawQuery() string {
 }
 
 func (r *Request) Query(key string, defaultValue ...string) string {
-	if r.query == nil {
-		r.query = r.Request.URL.Query()
-	}
-	value := r.query.Get(key)
+	value := r.queryValues().Get(key)
 	if len(value) == 0 && len(defaultValue) > 0 {
 		return defaultValue[0]
 	}
 	return value
 }
 
+func (r *Request) queryValues() url.Values {
+	if r.query == nil {
+		r.query = r.Request.URL.Query()
+	}
+	return r.query
+}
+
+// BindQuery binds the query params to dst by tag, dst should be a pointer
+// to struct or map.
 func (r *Request) BindQuery(dst interface{}, tag ...string) error {
 	p := reflect.ValueOf(dst)
 	if p.Kind() != reflect.Ptr || p.IsNil() {
 		return errors.New("dst must be a pointer")
 	}
 
-	m := make(map[string]string)
-	segments := strings.Split(r.RawQuery(), "&")
-	for _, segment := range segments {
-		kv := strings.Split(segment, "=")
-		if len(kv) > 1 {
-			m[kv[0]] = kv[1]
-		}
-	}
-
-	return mapTo(p.Elem(), m, tag...)
+	return mapTo(p.Elem(), SourceQuery, r.queryValues(), tag...)
 }
 
-// Body returns the request body.
+// Body returns the request body, the read error is set to the context
+// and an empty body is returned.
+// The body is read once, and Request.Body of http.Request is restored
+// to a reader of it, so it can still be read by the later handlers.
 func (r *Request) Body() []byte {
-	if r.body == nil {
-		b, _ := io.ReadAll(r.Request.Body)
-		r.body = b
+	body, _ := r.ReadBody()
+	return body
+}
+
+// ReadBody reads the whole request body once, it responds 413 and returns
+// ErrBodyTooLarge if the body exceeds the limit.
+func (r *Request) ReadBody() ([]byte, error) {
+	if r.body != nil {
+		return r.body, r.bodyErr
+	}
+
+	body, err := io.ReadAll(r.Request.Body)
+	if err != nil {
+		body = []byte{}
+		r.bodyErr = r.bodyError(err)
+	}
+	if body == nil {
+		body = []byte{}
 	}
-	return r.body
+	r.body = body
+	r.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return r.body, r.bodyErr
 }
 
 func (r *Request) BindJSON(dst interface{}) error {
-	return json.Unmarshal(r.Body(), dst)
+	body, err := r.ReadBody()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, dst)
 }
 
 func (r *Request) JSON(key string) interface{} {
@@ -85,15 +116,82 @@ func (r *Request) JSON(key string) interface{} {
 }
 
 func (r *Request) Forms(key string) string {
-	if r.PostForm == nil {
-		_ = r.ParseMultipartForm(MaxMultipartMemory)
-	}
+	_ = r.parseMultipartForm()
 	return r.PostForm.Get(key)
 }
 
 func (r *Request) File(key string) []*multipart.FileHeader {
-	if r.PostForm == nil {
-		_ = r.ParseMultipartForm(MaxMultipartMemory)
+	if r.parseMultipartForm() != nil || r.MultipartForm == nil {
+		return nil
 	}
 	return r.MultipartForm.File[key]
 }
+
+// parseMultipartForm parses the multipart or url encoded form once,
+// the error is set to the context.
+func (r *Request) parseMultipartForm() error {
+	if r.PostForm != nil {
+		return nil
+	}
+	err := r.ParseMultipartForm(r.multipartMemory())
+	if err == http.ErrNotMultipart {
+		err = nil
+	}
+	return r.bodyError(err)
+}
+
+// multipartMemory returns the max memory to parse multipart form,
+// which is MaxMultipartMemory unless the body limit is lower.
+func (r *Request) multipartMemory() int64 {
+	if r.limited != nil && r.limited.limit < MaxMultipartMemory {
+		return r.limited.limit
+	}
+	return MaxMultipartMemory
+}
+
+// limitBody limits the request body to n bytes, the limit replaces the
+// previous one rather than the lower one is applied.
+func (r *Request) limitBody(w http.ResponseWriter, n int64) {
+	if r.rawBody == nil {
+		r.rawBody = r.Request.Body
+	}
+	r.limited = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.rawBody, n), limit: n}
+	r.Request.Body = r.limited
+}
+
+// bodyError converts the error of reading body to ErrBodyTooLarge
+// and responds 413 if the body exceeds the limit, the error is also
+// set to the context.
+func (r *Request) bodyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if r.limited != nil && r.limited.exceeded {
+		err = ErrBodyTooLarge
+		if r.ctx != nil {
+			r.ctx.Response.Status(http.StatusRequestEntityTooLarge)
+		}
+	}
+	if r.ctx != nil {
+		r.ctx.Error(err)
+	}
+	return err
+}
+
+// limitedBody records whether the body limited by http.MaxBytesReader
+// exceeds the limit.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		b.exceeded = true
+	}
+	return n, err
+}
@@ -0,0 +1,90 @@
+package shack
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	var err error
+	var body, raw string
+	r := NewRouter()
+	r.BodyLimit(8)
+	r.POST("/small", func(ctx *Context) {
+		var b []byte
+		b, err = ctx.Request.ReadBody()
+		body = string(b)
+	})
+	r.POST("/large", func(ctx *Context) {
+		var b []byte
+		b, err = ctx.Request.ReadBody()
+		body = string(b)
+	}).BodyLimit(16)
+	r.Group("/upload", func(r *Router) {
+		r.BodyLimit(128)
+		r.POST("/", func(ctx *Context) {
+			var b []byte
+			b, err = ctx.Request.ReadBody()
+			body = string(b)
+		})
+	})
+	r.POST("/bind", func(ctx *Context) {
+		var dst struct {
+			Name string `json:"name"`
+		}
+		err = ctx.Bind(&dst)
+	})
+	r.POST("/stream", func(ctx *Context) {
+		_ = ctx.Request.JSON("name")
+		b, _ := io.ReadAll(ctx.Request.Request.Body)
+		raw = string(b)
+	})
+
+	tests := []struct {
+		path          string
+		body          string
+		contentLength int64
+		code          int
+		err           error
+	}{
+		{"/small", "12345678", -1, http.StatusOK, nil},
+		{"/small", "123456789", -1, http.StatusRequestEntityTooLarge, ErrBodyTooLarge},
+		{"/small", "123456789", 9, http.StatusRequestEntityTooLarge, nil},
+		{"/large", "0123456789abcdef", -1, http.StatusOK, nil},
+		{"/large", "0123456789abcdefg", -1, http.StatusRequestEntityTooLarge, ErrBodyTooLarge},
+		{"/large", "0123456789abcdef", 16, http.StatusOK, nil},
+		{"/large", "0123456789abcdefg", 17, http.StatusRequestEntityTooLarge, nil},
+		{"/upload", strings.Repeat("x", 100), -1, http.StatusOK, nil},
+		{"/upload", strings.Repeat("x", 100), 100, http.StatusOK, nil},
+		{"/upload", strings.Repeat("x", 129), 129, http.StatusRequestEntityTooLarge, nil},
+		{"/bind", `{"name":"foobar"}`, -1, http.StatusRequestEntityTooLarge, ErrBodyTooLarge},
+	}
+	for i, test := range tests {
+		err, body = nil, ""
+		req := httptest.NewRequest(_POST, test.path, strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.ContentLength = test.contentLength
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != test.code {
+			t.Errorf("test %d: expected code %d, got %d", i, test.code, w.Code)
+		}
+		if !errors.Is(err, test.err) {
+			t.Errorf("test %d: expected error %v, got %v", i, test.err, err)
+		}
+		if test.err == nil && test.code == http.StatusOK && body != test.body {
+			t.Errorf("test %d: expected body %s, got %s", i, test.body, body)
+		}
+	}
+
+	req := httptest.NewRequest(_POST, "/stream", strings.NewReader(`{"a":1}`))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if raw != `{"a":1}` {
+		t.Errorf("body should be readable after buffered, got %s", raw)
+	}
+}
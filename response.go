@@ -1,7 +1,12 @@
 package shack
 
 import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/ichxxx/shack/utils"
 	"github.com/valyala/bytebufferpool"
@@ -14,6 +19,9 @@ type Response struct {
 	StatusCode int
 	body       *bytebufferpool.ByteBuffer
 	hasFlush   bool
+	streaming  bool
+	hijacked   bool
+	noBody     bool
 }
 
 func (r *Response) Header(key, value string) {
@@ -21,14 +29,20 @@ func (r *Response) Header(key, value string) {
 }
 
 func (r *Response) Write(data []byte) error {
+	if r.hijacked {
+		return http.ErrHijacked
+	}
+	if r.streaming {
+		_, err := r.ResponseWriter.Write(data)
+		return err
+	}
 	_, err := r.bodyBuffer().Write(data)
 	return err
 }
 
 func (r *Response) String(s string) error {
 	r.Header("Content-Type", "text/plain")
-	_, err := r.bodyBuffer().Write(utils.UnsafeBytes(s))
-	return err
+	return r.Write(utils.UnsafeBytes(s))
 }
 
 func (r *Response) JSON(data interface{}) error {
@@ -41,15 +55,106 @@ func (r *Response) JSON(data interface{}) error {
 	return r.Write(bytes)
 }
 
+// Stream switches the response into streaming mode and calls step
+// until it returns false or writing to the client fails.
+// Headers are sent before the first call, and every chunk written
+// by step is flushed to the client once step returns, so the body
+// is never accumulated in memory.
+// The writer passed to step also implements http.Flusher.
+func (r *Response) Stream(step func(w io.Writer) bool) error {
+	w := r.beginStream()
+	for w.err == nil && step(w) {
+		w.Flush()
+	}
+	return w.err
+}
+
+// Streaming reports whether the response is in streaming mode.
+func (r *Response) Streaming() bool {
+	return r.streaming
+}
+
+// Hijack lets the caller take over the connection, nothing will be
+// written by the response after that.
+func (r *Response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if r.hijacked {
+		return nil, nil, http.ErrHijacked
+	}
+	hj, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("shack: response writer doesn't support hijacking")
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	r.hijacked = true
+	r.hasFlush = true
+	if r.body != nil {
+		responseBodyPool.Put(r.body)
+		r.body = nil
+	}
+	return conn, rw, nil
+}
+
+// Hijacked reports whether the connection has been hijacked.
+func (r *Response) Hijacked() bool {
+	return r.hijacked
+}
+
+// Flush writes the status and the buffered body to the client.
+// It's a no-op once the response has been flushed or switched into
+// streaming mode, or the connection has been hijacked.
 func (r *Response) Flush() error {
 	if r.hasFlush {
 		return nil
 	}
 	r.hasFlush = true
+	if r.noBody && r.body != nil {
+		if len(r.ResponseWriter.Header().Get("Content-Length")) == 0 {
+			r.Header("Content-Length", strconv.Itoa(r.body.Len()))
+		}
+		responseBodyPool.Put(r.body)
+		r.body = nil
+	}
 	if r.StatusCode != 0 {
 		r.ResponseWriter.WriteHeader(r.StatusCode)
 	}
+	return r.flushBody()
+}
+
+func (r *Response) beginStream() *streamWriter {
+	w := &streamWriter{ResponseWriter: r.ResponseWriter}
+	w.flusher, _ = r.ResponseWriter.(http.Flusher)
+	if r.hijacked {
+		w.err = http.ErrHijacked
+		return w
+	}
+	if r.streaming {
+		return w
+	}
+
+	if !r.hasFlush {
+		r.hasFlush = true
+		if r.StatusCode == 0 {
+			r.StatusCode = http.StatusOK
+		}
+		r.ResponseWriter.WriteHeader(r.StatusCode)
+		w.err = r.flushBody()
+	}
+	r.streaming = true
+	w.Flush()
+	return w
+}
+
+func (r *Response) flushBody() error {
+	if r.body == nil {
+		return nil
+	}
 	_, err := r.ResponseWriter.Write(r.body.Bytes())
+	responseBodyPool.Put(r.body)
+	r.body = nil
 	return err
 }
 
@@ -75,3 +180,28 @@ func (r *Response) bodyBuffer() *bytebufferpool.ByteBuffer {
 	}
 	return r.body
 }
+
+// streamWriter writes directly to the client and passes Flush
+// through to the underlying http.Flusher if there is one.
+type streamWriter struct {
+	http.ResponseWriter
+	flusher http.Flusher
+	err     error
+}
+
+func (w *streamWriter) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err = w.ResponseWriter.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return
+}
+
+func (w *streamWriter) Flush() {
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+}
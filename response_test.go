@@ -0,0 +1,89 @@
+package shack
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContextJSON(t *testing.T) {
+	r := NewRouter()
+	r.GET("/example/:id", func(ctx *Context) {
+		_ = ctx.JSON(M{"id": ctx.Param("id")})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(_GET, "/example/42", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("unexpected content type:%s", ct)
+	}
+	if body := w.Body.String(); body != `{"id":"42"}` {
+		t.Errorf("unexpected body:%s", body)
+	}
+}
+
+func TestResponseStream(t *testing.T) {
+	r := NewRouter()
+	r.GET("/stream", func(ctx *Context) {
+		ctx.Response.Header("Content-Type", "text/plain")
+		i := 0
+		_ = ctx.Response.Stream(func(w io.Writer) bool {
+			if _, ok := w.(http.Flusher); !ok {
+				t.Error("stream writer should implement http.Flusher")
+			}
+			fmt.Fprintf(w, "chunk%d;", i)
+			i++
+			return i < 3
+		})
+		_ = ctx.Response.String("tail")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(_GET, "/stream", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expecting status:%d, got:%d", http.StatusOK, w.Code)
+	}
+	if !w.Flushed {
+		t.Error("expecting response to be flushed")
+	}
+	if body := w.Body.String(); body != "chunk0;chunk1;chunk2;tail" {
+		t.Errorf("unexpected body:%s", body)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	r := NewRouter()
+	r.GET("/events", func(ctx *Context) {
+		s := ctx.EventStream()
+		if s.LastEventID != "41" {
+			t.Errorf("expecting last event id:41, got:%s", s.LastEventID)
+		}
+		_ = s.Comment("hello")
+		_ = s.Send(Event{ID: "42", Event: "update", Retry: time.Second, Data: "a\nb"})
+		_ = s.Send(Event{Data: Map{"foo": 1}})
+		_ = s.Send(Event{Data: "x\rid: evil\r\ny"})
+		_ = s.Comment("c\rdata: injected")
+		if err := s.Send(Event{ID: "1\ndata: x", Data: "y"}); err != ErrInvalidEvent {
+			t.Errorf("expecting ErrInvalidEvent of id, got:%v", err)
+		}
+		if err := s.Send(Event{Event: "a\revent: b", Data: "y"}); err != ErrInvalidEvent {
+			t.Errorf("expecting ErrInvalidEvent of type, got:%v", err)
+		}
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(_GET, "/events", nil)
+	req.Header.Set("Last-Event-ID", "41")
+	r.ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("unexpected content type:%s", ct)
+	}
+	expected := ": hello\n\nid: 42\nevent: update\nretry: 1000\ndata: a\ndata: b\n\ndata: {\"foo\":1}\n\n" +
+		"data: x\ndata: id: evil\ndata: y\n\n: c\n: data: injected\n\n"
+	if body := w.Body.String(); body != expected {
+		t.Errorf("unexpected body:%q", body)
+	}
+}
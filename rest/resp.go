@@ -1,6 +1,8 @@
 package rest
 
 import (
+	"encoding/json"
+	"errors"
 	"strconv"
 	"sync"
 
@@ -28,7 +30,13 @@ type restErr struct {
 	err error
 }
 
+// MarshalJSON renders ValidationErrors as the messages keyed by fields,
+// and other errors as strings.
 func (e *restErr) MarshalJSON() ([]byte, error) {
+	var errs shack.ValidationErrors
+	if errors.As(e.err, &errs) {
+		return json.Marshal(errs.Map())
+	}
 	return []byte(strconv.Quote(e.Error())), nil
 }
 
@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -29,21 +30,26 @@ func TestResp(t *testing.T) {
 		Resp(ctx).Data(data).OK()
 	})
 
-	go shack.Run(":8080", r)
+	app := shack.NewApp().Listen("127.0.0.1:0", r)
+	if err := app.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer app.Stop(context.Background())
+	addr := app.Addrs()[0].String()
 
-	_, data := request(t, "127.0.0.1:8080", "GET", "/resp/1", nil)
+	_, data := request(t, addr, "GET", "/resp/1", nil)
 	result := map[string]interface{}{"status": 0.0, "msg": "success", "data": map[string]interface{}{"foo": "foo", "bar": 123.0}}
 	if !reflect.DeepEqual(data, result) {
 		t.Fatal(data)
 	}
 
-	_, data = request(t, "127.0.0.1:8080", "GET", "/resp/2", nil)
+	_, data = request(t, addr, "GET", "/resp/2", nil)
 	result = map[string]interface{}{"status": 2.0, "msg": "fail", "error": "fail"}
 	if !reflect.DeepEqual(data, result) {
 		t.Fatal(data)
 	}
 
-	_, data = request(t, "127.0.0.1:8080", "GET", "/resp/3", nil)
+	_, data = request(t, addr, "GET", "/resp/3", nil)
 	result = map[string]interface{}{"status": 0.0, "msg": "success", "data": map[string]interface{}{"foo": "bar"}}
 	if !reflect.DeepEqual(data, result) {
 		t.Fatal(data)
@@ -74,3 +80,23 @@ func request(t *testing.T, url, method, path string, body io.Reader) (*http.Resp
 	json.Unmarshal(respBody, &data)
 	return resp, data
 }
+
+func TestRespValidationErrors(t *testing.T) {
+	errs := shack.ValidationErrors{
+		{Field: "Name", Rule: "required"},
+		{Field: "Age", Rule: "min", Param: "18"},
+	}
+	b, err := json.Marshal(&restErr{err: errs})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"Name": "is required", "Age": "must be at least 18"}
+	if !reflect.DeepEqual(data, expected) {
+		t.Fatal(data)
+	}
+}
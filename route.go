@@ -0,0 +1,55 @@
+package shack
+
+// Route is an endpoint added by one call of Router.Handle, Router.GET, etc.
+type Route struct {
+	router  *Router
+	pattern string
+	node    *trie
+	methods []string
+}
+
+// With adds one or more middlewares for the endpoint handler of the
+// route methods, they run in the order they are added, after the
+// middlewares of routers and before the handler.
+// The chain of each method is rebuilt, so the given slice is never
+// shared with other routes.
+func (r *Route) With(middlewares ...Handler) *Route {
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	defer r.router.changed()
+	for _, method := range r.methods {
+		handlers := r.node.handlers[method]
+		if len(handlers) == 0 {
+			continue
+		}
+
+		last := len(handlers) - 1
+		chain := make([]Handler, 0, len(handlers)+len(middlewares))
+		chain = append(chain, handlers[:last]...)
+		chain = append(chain, middlewares...)
+		chain = append(chain, handlers[last])
+		r.node.handlers[method] = chain
+	}
+	return r
+}
+
+// Name sets the name of the route, which can be used to build urls
+// by Router.URL. It panics if the name is already used.
+func (r *Route) Name(name string) *Route {
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	r.router.addName(name, newNamedRoute(r.pattern, r.methods))
+	return r
+}
+
+// BodyLimit limits the request body of the route to n bytes, it replaces
+// the limit of routers. See Router.BodyLimit.
+func (r *Route) BodyLimit(n int64) *Route {
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	defer r.router.changed()
+	for _, method := range r.methods {
+		r.node.setBodyLimit(method, n)
+	}
+	return r
+}
@@ -1,15 +1,21 @@
 package shack
 
 import (
-	"bytes"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ichxxx/shack/utils"
 )
 
-var slashBytes = []byte("/")
+var (
+	getMethod = []byte(_GET)
+	// routesMutex guards the routes and middlewares of all routers, which
+	// are changed by the registering methods and read by compiling.
+	routesMutex sync.RWMutex
+)
 
 type Router struct {
 	sub                     map[string]*Router
@@ -17,6 +23,47 @@ type Router struct {
 	middlewares             []Handler
 	notFountHandler         Handler
 	methodNotAllowedHandler Handler
+	// bodyLimit is the body limit of the routes, see Router.BodyLimit.
+	bodyLimit int64
+	// names are the named routes of the router, the ones of sub routers
+	// are kept by the sub routers.
+	names map[string]namedRoute
+	// parents are the routers the router is grouped or mounted into,
+	// whose tables are outdated once the router changes.
+	parents []*Router
+	// version is increased whenever the routes or middlewares of the
+	// router or its sub routers change.
+	version uint64
+	// table is the compiled *routeTable, which is replaced as a whole
+	// rather than modified, so the requests in flight keep using the
+	// table they got.
+	table        atomic.Value
+	compileMutex sync.Mutex
+}
+
+// routeTable is the compiled routes of a router, root is a copy of the
+// trie taken when compiling, so the requests never see the routes being
+// added. The chain of a route is the middlewares of routers along the
+// route pattern, the middlewares of the route and the handler.
+type routeTable struct {
+	version  uint64
+	root     *trie
+	nodes    map[*trie]*nodeChains
+	notFound []Handler
+}
+
+// nodeChains are the compiled chains of a trie node.
+type nodeChains struct {
+	chains     map[string][]Handler
+	notAllowed []Handler
+	options    []Handler
+}
+
+func (c *nodeChains) chain(method string) []Handler {
+	if chain := c.chains[method]; chain != nil {
+		return chain
+	}
+	return c.chains[_ALL]
 }
 
 func NewRouter() *Router {
@@ -27,88 +74,212 @@ func NewRouter() *Router {
 }
 
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	table, _ := r.table.Load().(*routeTable)
+	if table == nil || table.version != atomic.LoadUint64(&r.version) {
+		table = r.compile()
+	}
+
 	c := getContext(req, w)
-	c.handlers = append(c.handlers, getMiddlewares(r, utils.UnsafeBytes(c.Request.Path()))...)
-	r.handler(c)
+	r.handler(c, table)
 	releaseContext(c)
 }
 
-func getMiddlewares(r *Router, path []byte) (middlewares []Handler) {
-	middlewares = append(middlewares, r.middlewares...)
-	if len(path) <= 0 || bytes.Equal(path, slashBytes) {
-		return
+// changed outdates the tables of the router and the routers it's
+// grouped or mounted into, it's called with routesMutex locked.
+func (r *Router) changed() {
+	atomic.AddUint64(&r.version, 1)
+	for _, parent := range r.parents {
+		parent.changed()
 	}
+}
 
-	path = path[1:]
+// addParent records parent as a router r is attached to.
+func (r *Router) addParent(parent *Router) {
+	for _, p := range r.parents {
+		if p == parent {
+			return
+		}
+	}
+	r.parents = append(r.parents, parent)
+}
+
+// compile builds a new routeTable if the current one is outdated and
+// returns the up-to-date table.
+func (r *Router) compile() *routeTable {
+	r.compileMutex.Lock()
+	defer r.compileMutex.Unlock()
+	routesMutex.RLock()
+	defer routesMutex.RUnlock()
+
+	version := atomic.LoadUint64(&r.version)
+	if table, _ := r.table.Load().(*routeTable); table != nil && table.version == version {
+		return table
+	}
+
+	table := &routeTable{version: version, root: r.trie.clone(), nodes: make(map[*trie]*nodeChains)}
+	_ = eachTrie(table.root, r, "", r.middlewares, r.bodyLimit, func(t *trie, _ string, middlewares []Handler, limit int64) error {
+		if len(t.handlers) == 0 {
+			return nil
+		}
 
-	for pattern, router := range r.sub {
-		if patternBytes := utils.UnsafeBytes(pattern); bytes.HasPrefix(path, patternBytes) {
-			nextPath := bytes.TrimPrefix(path, patternBytes)
-			if len(nextPath) > 0 {
-				middlewares = append(middlewares, getMiddlewares(router, nextPath)...)
+		c := &nodeChains{chains: make(map[string][]Handler, len(t.handlers))}
+		for method, handlers := range t.handlers {
+			// the limit of route replaces the one of routers, and it's
+			// checked before all the middlewares.
+			mws, n := middlewares, limit
+			if routeLimit := t.bodyLimits[method]; routeLimit > 0 {
+				n = routeLimit
 			}
+			if n > 0 {
+				mws = joinHandlers([]Handler{bodyLimit(n)}, middlewares...)
+			}
+			c.chains[method] = joinHandlers(mws, handlers...)
 		}
-	}
-	return
+		c.notAllowed = joinHandlers(middlewares, r.methodNotAllowed)
+		c.options = joinHandlers(middlewares, optionsHandler)
+		table.nodes[t] = c
+		return nil
+	})
+	table.notFound = joinHandlers(r.middlewares, r.notFound)
+	r.table.Store(table)
+	return table
 }
 
-func (r *Router) handler(ctx *Context) {
-	handlers, params, ok := r.trie.search(utils.UnsafeBytes(ctx.Request.Method()), utils.UnsafeBytes(ctx.Request.Path()))
-	if ok && len(handlers) > 0 {
-		ctx.PathParams = params
-		ctx.handlers = append(ctx.handlers, handlers...)
-		ctx.Next()
-	} else if ok {
-		// todo: 如果是模糊节点，且没有handler，会通过判断，待修复
-		ctx.Response.Status(http.StatusMethodNotAllowed)
-		if r.methodNotAllowedHandler != nil {
-			r.methodNotAllowedHandler(ctx)
+func joinHandlers(middlewares []Handler, handlers ...Handler) []Handler {
+	chain := make([]Handler, 0, len(middlewares)+len(handlers))
+	chain = append(chain, middlewares...)
+	return append(chain, handlers...)
+}
+
+func (r *Router) handler(ctx *Context, table *routeTable) {
+	method := ctx.Request.Method()
+	path := utils.UnsafeBytes(ctx.Request.Path())
+	node, handlers, params := table.root.search(utils.UnsafeBytes(method), path)
+	if handlers == nil && method == _HEAD {
+		// serve HEAD via the GET handler with the body discarded
+		if n, h, p := table.root.search(getMethod, path); h != nil {
+			node, handlers, params = n, h, p
+			method = _GET
+			ctx.Response.noBody = true
 		}
-	} else {
-		ctx.Response.Status(http.StatusNotFound)
-		if r.notFountHandler != nil {
-			r.notFountHandler(ctx)
+	}
+
+	ctx.PathParams = params
+	// chains is nil if the node isn't found
+	chains := table.nodes[node]
+	switch {
+	case chains == nil:
+		ctx.handlers = table.notFound
+	case handlers != nil:
+		ctx.handlers = chains.chain(method)
+	default:
+		ctx.Response.Header("Allow", node.allow())
+		if method == _OPTIONS {
+			ctx.handlers = chains.options
+		} else {
+			ctx.handlers = chains.notAllowed
 		}
 	}
+	ctx.Next()
+}
+
+func (r *Router) notFound(ctx *Context) {
+	ctx.Response.Status(http.StatusNotFound)
+	if r.notFountHandler != nil {
+		r.notFountHandler(ctx)
+	}
 }
 
-func (r *Router) Handle(pattern string, handler Handler) *trie {
-	return r.trie.insert(pattern, handler, _ALL)
+func (r *Router) methodNotAllowed(ctx *Context) {
+	ctx.Response.Status(http.StatusMethodNotAllowed)
+	if r.methodNotAllowedHandler != nil {
+		r.methodNotAllowedHandler(ctx)
+	}
 }
 
-func (r *Router) GET(pattern string, handler Handler) *trie {
-	return r.trie.insert(pattern, handler, _GET)
+func optionsHandler(ctx *Context) {
+	ctx.Response.Status(http.StatusNoContent)
 }
 
-func (r *Router) POST(pattern string, handler Handler) *trie {
-	return r.trie.insert(pattern, handler, _POST)
+// Handle adds a route for the methods, it matches all methods if
+// no method is given.
+func (r *Router) Handle(pattern string, handler Handler, methods ...string) *Route {
+	if len(methods) == 0 {
+		methods = []string{_ALL}
+	}
+	return r.route(pattern, handler, methods...)
 }
 
-func (r *Router) DELETE(pattern string, handler Handler) *trie {
-	return r.trie.insert(pattern, handler, _DELETE)
+func (r *Router) GET(pattern string, handler Handler) *Route {
+	return r.route(pattern, handler, _GET)
 }
 
-func (r *Router) PUT(pattern string, handler Handler) *trie {
-	return r.trie.insert(pattern, handler, _PUT)
+func (r *Router) POST(pattern string, handler Handler) *Route {
+	return r.route(pattern, handler, _POST)
 }
 
-func (r *Router) PATCH(pattern string, handler Handler) *trie {
-	return r.trie.insert(pattern, handler, _PATCH)
+func (r *Router) DELETE(pattern string, handler Handler) *Route {
+	return r.route(pattern, handler, _DELETE)
 }
 
-func (r *Router) OPTIONS(pattern string, handler Handler) *trie {
-	return r.trie.insert(pattern, handler, _OPTIONS)
+func (r *Router) PUT(pattern string, handler Handler) *Route {
+	return r.route(pattern, handler, _PUT)
 }
 
-func (r *Router) HEAD(pattern string, handler Handler) *trie {
-	return r.trie.insert(pattern, handler, _HEAD)
+func (r *Router) PATCH(pattern string, handler Handler) *Route {
+	return r.route(pattern, handler, _PATCH)
+}
+
+func (r *Router) OPTIONS(pattern string, handler Handler) *Route {
+	return r.route(pattern, handler, _OPTIONS)
+}
+
+func (r *Router) HEAD(pattern string, handler Handler) *Route {
+	return r.route(pattern, handler, _HEAD)
+}
+
+func (r *Router) route(pattern string, handler Handler, methods ...string) *Route {
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	defer r.changed()
+	methods = append([]string(nil), methods...)
+	return &Route{router: r, pattern: pattern, node: r.trie.insert(pattern, handler, methods...), methods: methods}
 }
 
 // Use appends one or more middlewares onto the router.
 func (r *Router) Use(middlewares ...Handler) {
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	defer r.changed()
 	r.middlewares = append(r.middlewares, middlewares...)
 }
 
+// BodyLimit limits the request body of the routes to n bytes, including
+// the routes of sub routers unless they have their own limits, and the
+// limit of a route replaces it. See Route.BodyLimit.
+// The limit is checked before all the middlewares, a request whose
+// Content-Length exceeds the limit is responded 413 without running the
+// handlers, and reading a body exceeding the limit by Request.Body or
+// binding fails with ErrBodyTooLarge and 413.
+func (r *Router) BodyLimit(n int64) {
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	defer r.changed()
+	r.bodyLimit = n
+}
+
+func bodyLimit(n int64) Handler {
+	return func(ctx *Context) {
+		if ctx.Request.ContentLength > n {
+			ctx.Response.Status(http.StatusRequestEntityTooLarge)
+			ctx.Error(ErrBodyTooLarge)
+			ctx.Abort()
+			return
+		}
+		ctx.Request.limitBody(ctx.Response.ResponseWriter, n)
+	}
+}
+
 // Mount attaches another router along a `pattern` string.
 func (r *Router) Mount(pattern string, router *Router) {
 	if !isValidPattern(pattern) {
@@ -118,14 +289,28 @@ func (r *Router) Mount(pattern string, router *Router) {
 	if router == nil {
 		panic(fmt.Sprintf("shack: router is nil while mounting '%s'", pattern))
 	}
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	defer r.changed()
 
-	if r.sub[pattern] != nil {
-		panic(fmt.Sprintf("shack: pattern '%s' to mount is already exist", pattern))
+	segments := strings.Split(pattern, "/")
+	segmentsLen := len(segments)
+	root := r
+	for _, segment := range segments[1 : segmentsLen-1] {
+		root = root.subRouter(segment)
 	}
 
-	// todo: should use mergeSubRouter and mergeSubTrie ?
-	r.sub[pattern] = router
-	r.trie.childs[pattern[1:]] = router.trie
+	last := segments[segmentsLen-1]
+	if root.sub[last] != nil {
+		panic(fmt.Sprintf("shack: pattern '%s' to mount is already exist", pattern))
+	}
+	if child, ok := root.trie.childs[last]; ok {
+		router.trie.merge(child, pattern)
+	}
+	root.sub[last] = router
+	root.trie.childs[last] = router.trie
+	router.addParent(root)
+	r.checkNames()
 }
 
 // Group adds a sub-Router to the group along a `pattern` string.
@@ -141,33 +326,24 @@ func (r *Router) Group(pattern string, routeFunc func(r *Router)) *Router {
 	sub := NewRouter()
 	routeFunc(sub)
 
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	defer r.changed()
 	if pattern == "/" {
-		for method, handler := range sub.trie.handlers {
-			root.trie.handlers[method] = handler
-		}
-
-		for key, ss := range sub.sub {
-			mergeSubRouter(root, ss, key)
-		}
-		for key, st := range sub.trie.childs {
-			mergeSubTrie(root.trie, st, key)
-		}
+		r.merge(sub)
 		return r
 	}
 
 	segments := strings.Split(pattern, "/")
 	segmentsLen := len(segments)
 	for _, segment := range segments[1 : segmentsLen-1] {
-		if root.sub[segment] == nil {
-			next := NewRouter()
-			root.sub[segment] = next
-			root.trie.childs[segment] = next.trie
-		}
-		root = root.sub[segment]
+		root = root.subRouter(segment)
 	}
 
 	mergeSubRouter(root, sub, segments[segmentsLen-1])
-	mergeSubTrie(root.trie, sub.trie, segments[segmentsLen-1])
+	mergeSubTrie(root.trie, sub.trie, segments[segmentsLen-1], pattern)
+	root.align()
+	r.checkNames()
 	return root.sub[segments[segmentsLen-1]]
 }
 
@@ -177,37 +353,97 @@ func (r *Router) Add(routeFunc func(r *Router)) *Router {
 		return r
 	}
 
-	root := r
 	sub := NewRouter()
 	routeFunc(sub)
-	for method, handler := range sub.trie.handlers {
-		root.trie.handlers[method] = handler
-	}
 
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	defer r.changed()
+	r.merge(sub)
+	return r
+}
+
+// merge merges the routes of sub into r along "/", the middlewares of sub
+// are moved into its routes, so they don't apply to the existing routes.
+func (r *Router) merge(sub *Router) {
+	sub.flattenMiddlewares(nil)
 	for key, ss := range sub.sub {
-		mergeSubRouter(root, ss, key)
+		mergeSubRouter(r, ss, key)
 	}
-	for key, st := range sub.trie.childs {
-		mergeSubTrie(root.trie, st, key)
+	r.trie.merge(sub.trie, "/")
+	r.mergeNames(sub)
+	r.align()
+	r.checkNames()
+}
+
+// flattenMiddlewares prepends middlewares and the ones of r and its sub
+// routers to the handlers of their routes, and clears the middlewares of
+// the routers.
+func (r *Router) flattenMiddlewares(middlewares []Handler) {
+	if len(r.middlewares) > 0 {
+		middlewares = append(middlewares[:len(middlewares):len(middlewares)], r.middlewares...)
+		r.middlewares = nil
+	}
+	r.trie.prepend(middlewares, r.sub)
+	for _, sub := range r.sub {
+		sub.flattenMiddlewares(middlewares)
 	}
-	return r
 }
 
 // NotFound defines a handler to respond whenever a route could
 // not be found.
 func (r *Router) NotFound(handler Handler) {
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	defer r.changed()
 	r.notFountHandler = handler
 }
 
 // MethodNotAllowed defines a handler to respond whenever a method is
 // not allowed.
 func (r *Router) MethodNotAllowed(handler Handler) {
+	routesMutex.Lock()
+	defer routesMutex.Unlock()
+	defer r.changed()
 	r.methodNotAllowedHandler = handler
 }
 
+// subRouter returns the sub router along segment, a new one is added
+// if not exist.
+func (r *Router) subRouter(segment string) *Router {
+	if r.sub[segment] == nil {
+		next := NewRouter()
+		if child, ok := r.trie.childs[segment]; ok {
+			next.trie = child
+		} else {
+			r.trie.childs[segment] = next.trie
+		}
+		next.addParent(r)
+		r.sub[segment] = next
+	}
+	return r.sub[segment]
+}
+
+// align points the tries of sub routers to the childs of the router trie,
+// they could be replaced while merging.
+func (r *Router) align() {
+	for segment, sub := range r.sub {
+		if child, ok := r.trie.childs[segment]; ok {
+			sub.trie = child
+		} else {
+			r.trie.childs[segment] = sub.trie
+		}
+		sub.align()
+	}
+}
+
 func mergeSubRouter(root, sub *Router, pattern string) {
 	if root.sub[pattern] != nil {
 		root.sub[pattern].middlewares = append(root.sub[pattern].middlewares, sub.middlewares...)
+		root.sub[pattern].mergeNames(sub)
+		if sub.bodyLimit > 0 {
+			root.sub[pattern].bodyLimit = sub.bodyLimit
+		}
 		for key, r := range sub.sub {
 			mergeSubRouter(root.sub[pattern], r, key)
 		}
@@ -215,15 +451,16 @@ func mergeSubRouter(root, sub *Router, pattern string) {
 	}
 
 	root.sub[pattern] = sub
+	sub.addParent(root)
 }
 
-func mergeSubTrie(root, sub *trie, pattern string) {
-	if next, found := root.childs[pattern]; found {
-		for key, t := range sub.childs {
-			mergeSubTrie(next, t, key)
-		}
+// mergeSubTrie merges sub into the child of root along segment, path is
+// the full pattern of the child.
+func mergeSubTrie(root, sub *trie, segment, path string) {
+	if next, found := root.childs[segment]; found {
+		next.merge(sub, path)
 		return
 	}
 
-	root.childs[pattern] = sub
+	root.childs[segment] = sub
 }
@@ -0,0 +1,460 @@
+package shack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestRouterMethods(t *testing.T) {
+	r := NewRouter()
+	r.GET("/foo", func(ctx *Context) {
+		_ = ctx.Response.String("foo")
+	})
+	r.POST("/foo", func(ctx *Context) {})
+	r.GET("/bar/:id/baz", func(ctx *Context) {})
+	r.Handle("/all", func(ctx *Context) {})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		allow  string
+		body   string
+	}{
+		{_GET, "/foo", http.StatusOK, "", "foo"},
+		{_HEAD, "/foo", http.StatusOK, "", ""},
+		{_OPTIONS, "/foo", http.StatusNoContent, "GET, HEAD, OPTIONS, POST", ""},
+		{_DELETE, "/foo", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS, POST", ""},
+		{_OPTIONS, "/all", http.StatusOK, "", ""},
+		{_GET, "/bar/1", http.StatusNotFound, "", ""},
+		{_GET, "/bar/1/qux", http.StatusNotFound, "", ""},
+		{_PUT, "/bar/1/baz", http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS", ""},
+	}
+
+	for i, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.code {
+			t.Errorf("input [%d]: expecting code:%d, got:%d", i, test.code, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != test.allow {
+			t.Errorf("input [%d]: expecting allow:%s, got:%s", i, test.allow, allow)
+		}
+		if body := w.Body.String(); body != test.body {
+			t.Errorf("input [%d]: expecting body:%s, got:%s", i, test.body, body)
+		}
+	}
+}
+
+func TestRouterHeadContentLength(t *testing.T) {
+	r := NewRouter()
+	r.GET("/foo", func(ctx *Context) {
+		_ = ctx.Response.String("foo")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(_HEAD, "/foo", nil))
+	if cl := w.Header().Get("Content-Length"); cl != "3" {
+		t.Errorf("expecting content length:3, got:%s", cl)
+	}
+}
+
+func testMiddleware(ctx *Context) {}
+
+func testHandler(ctx *Context) {}
+
+func TestRouterRoutes(t *testing.T) {
+	api := NewRouter()
+	api.Use(testMiddleware)
+	api.GET("/users/:id<int>", testHandler)
+
+	r := NewRouter()
+	r.Use(testMiddleware)
+	r.GET("/", testHandler)
+	r.GET("/api/v1/ping", testHandler)
+	r.Mount("/api/v1", api)
+	r.Group("/admin", func(r *Router) {
+		r.Use(testMiddleware)
+		r.POST("/files/*path", testHandler).With(testMiddleware)
+	})
+
+	mw := "github.com/ichxxx/shack.testMiddleware"
+	h := "github.com/ichxxx/shack.testHandler"
+	expected := []RouteInfo{
+		{_GET, "/", h, []string{mw}},
+		{_POST, "/admin/files/*path", h, []string{mw, mw, mw}},
+		{_GET, "/api/v1/ping", h, []string{mw, mw}},
+		{_GET, "/api/v1/users/:id<int>", h, []string{mw, mw}},
+	}
+	if routes := r.Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("expecting routes:%v, got:%v", expected, routes)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(_GET, "/api/v1/ping", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expecting code:%d, got:%d", http.StatusOK, w.Code)
+	}
+}
+
+func TestRouterURL(t *testing.T) {
+	api := NewRouter()
+	api.GET("/users/:id<int>", testHandler).Name("user.show")
+	api.GET("/files/*path", testHandler).Name("file.show")
+
+	api.GET("/posts/:id", testHandler).Name("post.get")
+	api.PUT("/posts/:id", testHandler).Name("post.update")
+
+	r := NewRouter()
+	r.GET("/", testHandler).Name("index")
+	r.Mount("/api", api)
+	r.Group("/admin/v1", func(r *Router) {
+		r.GET("/posts/:slug", testHandler).Name("post.show")
+	})
+
+	tests := []struct {
+		name   string
+		params []interface{}
+		url    string
+		ok     bool
+	}{
+		{"index", nil, "/", true},
+		{"user.show", []interface{}{"id", 42}, "/api/users/42", true},
+		{"user.show", []interface{}{"id", "foo"}, "", false},
+		{"user.show", nil, "", false},
+		{"user.show", []interface{}{"id", 42, "foo", "bar"}, "", false},
+		{"file.show", []interface{}{"path", "/a b/c.png"}, "/api/files/a%20b/c.png", true},
+		{"post.show", []interface{}{"slug", "hello/world"}, "/admin/v1/posts/hello%2Fworld", true},
+		{"post.show", []interface{}{"slug"}, "", false},
+		{"post.get", []interface{}{"id", 1}, "/api/posts/1", true},
+		{"post.update", []interface{}{"id", 2}, "/api/posts/2", true},
+		{"none", nil, "", false},
+	}
+
+	for i, test := range tests {
+		url, err := r.URL(test.name, test.params...)
+		if url != test.url {
+			t.Errorf("input [%d]: expecting url:%s, got:%s", i, test.url, url)
+		}
+		if (err == nil) != test.ok {
+			t.Errorf("input [%d]: expecting ok:%v, got:%v", i, test.ok, err)
+		}
+	}
+}
+
+func TestRouterDuplicatedNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func()
+	}{
+		{"same router", func() {
+			r := NewRouter()
+			r.GET("/users/:id", testHandler).Name("user")
+			r.PUT("/users/:id", testHandler).Name("user")
+		}},
+		{"mount", func() {
+			api := NewRouter()
+			api.GET("/users", testHandler).Name("user")
+			r := NewRouter()
+			r.GET("/user", testHandler).Name("user")
+			r.Mount("/api", api)
+		}},
+		{"group", func() {
+			r := NewRouter()
+			r.GET("/user", testHandler).Name("user")
+			r.Group("/api", func(r *Router) {
+				r.GET("/users", testHandler).Name("user")
+			})
+		}},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expecting panic", test.name)
+				}
+			}()
+			test.build()
+		}()
+	}
+}
+
+func TestRouteWith(t *testing.T) {
+	var trace []string
+	mark := func(s string) Handler {
+		return func(ctx *Context) {
+			trace = append(trace, s)
+		}
+	}
+
+	r := NewRouter()
+	shared := make([]Handler, 1, 4)
+	shared[0] = mark("shared")
+	r.GET("/a", mark("a")).With(shared...)
+	r.GET("/b", mark("b")).With(shared...)
+
+	r.Handle("/multi", mark("multi"), _GET, _POST).With(mark("m1"))
+
+	single := r.GET("/single", mark("get"))
+	r.POST("/single", mark("post"))
+	single.With(mark("s1"))
+
+	r.GET("/chain", mark("chain")).With(mark("c1")).With(mark("c2"), mark("c3"))
+
+	tests := []struct {
+		method string
+		path   string
+		trace  []string
+	}{
+		{_GET, "/a", []string{"shared", "a"}},
+		{_GET, "/b", []string{"shared", "b"}},
+		{_GET, "/multi", []string{"m1", "multi"}},
+		{_POST, "/multi", []string{"m1", "multi"}},
+		{_GET, "/single", []string{"s1", "get"}},
+		{_POST, "/single", []string{"post"}},
+		{_GET, "/chain", []string{"c1", "c2", "c3", "chain"}},
+	}
+
+	for i, test := range tests {
+		trace = nil
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(test.method, test.path, nil))
+		if !reflect.DeepEqual(trace, test.trace) {
+			t.Errorf("input [%d]: expecting trace:%v, got:%v", i, test.trace, trace)
+		}
+	}
+}
+
+// The benchmarks compare the chains compiled once with the middlewares
+// collected by walking the sub routers on each request, run by
+// `go test -bench Router` on the same machine:
+//
+//	                         before                             after
+//	BenchmarkRouterStatic    ~470 ns/op   72 B/op   5 allocs    ~150 ns/op    0 B/op  0 allocs
+//	BenchmarkRouterParam    ~1340 ns/op  512 B/op  11 allocs    ~600 ns/op  336 B/op  2 allocs
+//	BenchmarkRouterNotFound  ~840 ns/op  136 B/op   8 allocs    ~145 ns/op    0 B/op  0 allocs
+func benchmarkRouter() *Router {
+	r := NewRouter()
+	r.Use(testMiddleware)
+	r.GET("/", testHandler)
+	r.GET("/static/foo/bar", testHandler)
+	r.Group("/api", func(r *Router) {
+		r.Use(testMiddleware)
+		r.Group("/v1", func(r *Router) {
+			r.Use(testMiddleware)
+			r.GET("/users/:id", testHandler).With(testMiddleware)
+		})
+	})
+	r.Group("/apiary", func(r *Router) {
+		r.GET("/bees", testHandler)
+	})
+	return r
+}
+
+func benchmarkServe(b *testing.B, r *Router, path string) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(_GET, path, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkRouterStatic(b *testing.B) {
+	benchmarkServe(b, benchmarkRouter(), "/static/foo/bar")
+}
+
+func BenchmarkRouterParam(b *testing.B) {
+	benchmarkServe(b, benchmarkRouter(), "/api/v1/users/42")
+}
+
+func BenchmarkRouterNotFound(b *testing.B) {
+	benchmarkServe(b, benchmarkRouter(), "/apiary/wasps")
+}
+
+func TestRouterMiddlewareSegments(t *testing.T) {
+	var trace []string
+	mark := func(s string) Handler {
+		return func(ctx *Context) {
+			trace = append(trace, s)
+		}
+	}
+
+	r := NewRouter()
+	r.Use(mark("root"))
+	r.Group("/api", func(r *Router) {
+		r.Use(mark("api"))
+		r.GET("/users", mark("users"))
+	})
+	r.GET("/apiary", mark("apiary"))
+	r.Group("/", func(r *Router) {
+		r.Use(mark("auth"))
+		r.GET("/admin", mark("admin"))
+		r.Group("/admin/v1", func(r *Router) {
+			r.Use(mark("v1"))
+			r.GET("/stats", mark("stats"))
+		})
+	})
+	r.Add(func(r *Router) {
+		r.Use(mark("add"))
+		r.GET("/added", mark("added"))
+	})
+
+	tests := []struct {
+		path  string
+		trace []string
+	}{
+		{"/api/users", []string{"root", "api", "users"}},
+		{"/apiary", []string{"root", "apiary"}},
+		{"/api/none", []string{"root"}},
+		{"/admin", []string{"root", "auth", "admin"}},
+		{"/admin/v1/stats", []string{"root", "auth", "v1", "stats"}},
+		{"/added", []string{"root", "add", "added"}},
+	}
+	for i, test := range tests {
+		trace = nil
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(_GET, test.path, nil))
+		if !reflect.DeepEqual(trace, test.trace) {
+			t.Errorf("input [%d]: expecting trace:%v, got:%v", i, test.trace, trace)
+		}
+	}
+
+	// routes added after serving are compiled on the next request
+	r.GET("/late", mark("late")).With(mark("with"))
+	trace = nil
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(_GET, "/late", nil))
+	if expected := []string{"root", "with", "late"}; !reflect.DeepEqual(trace, expected) {
+		t.Errorf("expecting trace:%v, got:%v", expected, trace)
+	}
+}
+
+func TestRouterCompileRace(t *testing.T) {
+	r := NewRouter()
+	r.GET("/ping", testHandler)
+	r.GET("/posts", testHandler)
+
+	// the changes of other routers don't outdate the table of r
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(_GET, "/ping", nil))
+	table := r.table.Load()
+	NewRouter().GET("/other", testHandler)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(_GET, "/ping", nil))
+	if r.table.Load() != table {
+		t.Error("table should not be recompiled by other routers")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			r.GET("/other/"+strconv.Itoa(i), testHandler)
+			r.POST("/other/"+strconv.Itoa(i), testHandler)
+			NewRouter().GET("/other", testHandler)
+		}
+		// a method added to an existing node
+		r.POST("/posts", testHandler)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(_GET, "/ping", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("expecting code:%d, got:%d", http.StatusOK, w.Code)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(_POST, "/posts", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expecting code:%d, got:%d", http.StatusOK, w.Code)
+	}
+}
+
+func TestRouterMergeConflicts(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func()
+	}{
+		{"mount param", func() {
+			api := NewRouter()
+			api.GET("/users/:uid/posts", testHandler)
+			r := NewRouter()
+			r.GET("/api/users/:id", testHandler)
+			r.Mount("/api", api)
+		}},
+		{"mount method", func() {
+			api := NewRouter()
+			api.GET("/users", testHandler)
+			r := NewRouter()
+			r.GET("/api/users", testHandler)
+			r.Mount("/api", api)
+		}},
+		{"group root method", func() {
+			r := NewRouter()
+			r.GET("/x", testHandler)
+			r.Group("/", func(r *Router) {
+				r.GET("/x", testHandler)
+			})
+		}},
+		{"group all method", func() {
+			r := NewRouter()
+			r.POST("/api/x", testHandler)
+			r.Group("/api", func(r *Router) {
+				r.Handle("/x", testHandler)
+			})
+		}},
+		{"add path", func() {
+			r := NewRouter()
+			r.GET("/files/*path", testHandler)
+			r.Add(func(r *Router) {
+				r.POST("/files/*name", testHandler)
+			})
+		}},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expecting panic", test.name)
+				}
+			}()
+			test.build()
+		}()
+	}
+
+	// the routes of different methods and names are merged
+	api := NewRouter()
+	api.POST("/users/:id", testHandler)
+	r := NewRouter()
+	r.GET("/api/users/:id", func(ctx *Context) {
+		_ = ctx.Response.String(ctx.Param("id"))
+	})
+	r.Mount("/api", api)
+	for _, method := range []string{_GET, _POST} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/api/users/5", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expecting code:%d, got:%d", method, http.StatusOK, w.Code)
+		}
+		if method == _GET && w.Body.String() != "5" {
+			t.Errorf("expecting param id:5, got:%s", w.Body.String())
+		}
+	}
+}
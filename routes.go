@@ -0,0 +1,295 @@
+package shack
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ErrSkipRoutes can be returned by a WalkFunc to stop walking.
+var ErrSkipRoutes = errors.New("shack: skip routes")
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	// Method is the http method, or "ALL" for routes added by Handle.
+	Method string
+	// Pattern is the full pattern including the prefixes of
+	// grouped and mounted routers.
+	Pattern string
+	// Handler is the function name of the endpoint handler.
+	Handler string
+	// Middlewares are the function names of the middlewares in the
+	// order they run, including the ones of the routers and the route.
+	Middlewares []string
+}
+
+// WalkFunc is called by Router.Walk for each route.
+type WalkFunc func(route RouteInfo) error
+
+// Routes returns all the registered routes sorted by pattern and method.
+func (r *Router) Routes() []RouteInfo {
+	var routes []RouteInfo
+	_ = r.Walk(func(route RouteInfo) error {
+		routes = append(routes, route)
+		return nil
+	})
+	return routes
+}
+
+// Walk calls fn for each registered route sorted by pattern and method,
+// it stops if fn returns an error, which is returned by Walk unless
+// it's ErrSkipRoutes.
+func (r *Router) Walk(fn WalkFunc) error {
+	routesMutex.RLock()
+	defer routesMutex.RUnlock()
+	err := eachTrie(r.trie, r, "", r.middlewares, r.bodyLimit, func(t *trie, pattern string, middlewares []Handler, _ int64) error {
+		return walkRoutes(t, pattern, middlewares, fn)
+	})
+	if err == ErrSkipRoutes {
+		return nil
+	}
+	return err
+}
+
+func walkRoutes(t *trie, pattern string, middlewares []Handler, fn WalkFunc) error {
+	methods := make([]string, 0, len(t.handlers))
+	for method := range t.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	for _, method := range methods {
+		handlers := t.handlers[method]
+		if len(handlers) == 0 {
+			continue
+		}
+
+		route := RouteInfo{
+			Method:  method,
+			Pattern: pattern,
+			Handler: nameOfHandler(handlers[len(handlers)-1]),
+		}
+		if len(route.Pattern) == 0 {
+			route.Pattern = "/"
+		}
+		for _, m := range middlewares {
+			route.Middlewares = append(route.Middlewares, nameOfHandler(m))
+		}
+		for _, m := range handlers[:len(handlers)-1] {
+			route.Middlewares = append(route.Middlewares, nameOfHandler(m))
+		}
+		if err := fn(route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachTrie calls fn for t and its descendants in order, with the pattern,
+// the middlewares and the body limit of routers along the pattern.
+// Sub routers are only attached to static childs, and their middlewares
+// apply to the whole segments rather than the prefix of path.
+func eachTrie(t *trie, router *Router, pattern string, middlewares []Handler, limit int64,
+	fn func(t *trie, pattern string, middlewares []Handler, limit int64) error) error {
+	if err := fn(t, pattern, middlewares, limit); err != nil {
+		return err
+	}
+
+	segments := make([]string, 0, len(t.childs))
+	for segment := range t.childs {
+		segments = append(segments, segment)
+	}
+	sort.Strings(segments)
+
+	for _, segment := range segments {
+		var sub *Router
+		mws, subLimit := middlewares, limit
+		if router != nil {
+			if sub = router.sub[segment]; sub != nil {
+				if len(sub.middlewares) > 0 {
+					mws = append(mws[:len(mws):len(mws)], sub.middlewares...)
+				}
+				if sub.bodyLimit > 0 {
+					subLimit = sub.bodyLimit
+				}
+			}
+		}
+		if err := eachTrie(t.childs[segment], sub, pattern+"/"+segment, mws, subLimit, fn); err != nil {
+			return err
+		}
+	}
+
+	for _, param := range t.params {
+		segment := ":" + param.p
+		if param.c != nil {
+			segment += "<" + param.c.expr + ">"
+		}
+		if err := eachTrie(param, nil, pattern+"/"+segment, middlewares, limit, fn); err != nil {
+			return err
+		}
+	}
+
+	if t.path != nil {
+		return eachTrie(t.path, nil, pattern+"/*"+t.path.p, middlewares, limit, fn)
+	}
+	return nil
+}
+
+func nameOfHandler(handler Handler) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer())
+	if fn == nil {
+		return ""
+	}
+	return strings.TrimSuffix(fn.Name(), "-fm")
+}
+
+// namedRoute is a route with name, segments are parsed from its pattern
+// relative to the router having the name, once it's named.
+type namedRoute struct {
+	methods  []string
+	segments []urlSegment
+}
+
+// urlSegment is a segment of named route, value is the static segment
+// or the key of param.
+type urlSegment struct {
+	value string
+	kind  byte // kind is _PARAM, _PATH or 0 for the static ones
+	c     *constraint
+}
+
+func newNamedRoute(pattern string, methods []string) namedRoute {
+	route := namedRoute{methods: methods}
+	for _, segment := range strings.Split(pattern, "/") {
+		if len(segment) == 0 {
+			continue
+		}
+		s := urlSegment{value: segment}
+		switch segment[0] {
+		case _PARAM:
+			s.kind = _PARAM
+			s.value, s.c = parseParam(segment[1:])
+		case _PATH:
+			s.kind, s.value = _PATH, segment[1:]
+		}
+		route.segments = append(route.segments, s)
+	}
+	return route
+}
+
+func (r *Router) addName(name string, route namedRoute) {
+	if len(name) == 0 {
+		panic("shack: route name can't be empty")
+	}
+	if _, ok := r.names[name]; ok {
+		panic(fmt.Sprintf("shack: route name '%s' is duplicated", name))
+	}
+	if r.names == nil {
+		r.names = make(map[string]namedRoute)
+	}
+	r.names[name] = route
+}
+
+func (r *Router) mergeNames(sub *Router) {
+	for name, route := range sub.names {
+		r.addName(name, route)
+	}
+}
+
+// eachName calls fn for each named route of r and its sub routers, with
+// the prefix of the router having the route.
+func (r *Router) eachName(prefix string, fn func(name, prefix string, route namedRoute) bool) bool {
+	for name, route := range r.names {
+		if !fn(name, prefix, route) {
+			return false
+		}
+	}
+	for segment, sub := range r.sub {
+		if !sub.eachName(prefix+"/"+segment, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkNames panics if a name is used by multiple routes of r and its
+// sub routers.
+func (r *Router) checkNames() {
+	names := make(map[string]struct{})
+	r.eachName("", func(name, _ string, _ namedRoute) bool {
+		if _, ok := names[name]; ok {
+			panic(fmt.Sprintf("shack: route name '%s' is duplicated", name))
+		}
+		names[name] = struct{}{}
+		return true
+	})
+}
+
+// URL builds the url of the route with the given name, the params
+// are the key and value pairs filling the :param and *path segments.
+func (r *Router) URL(name string, params ...interface{}) (string, error) {
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("shack: params of route '%s' should be key and value pairs", name)
+	}
+	var prefix string
+	var route namedRoute
+	found := false
+	routesMutex.RLock()
+	r.eachName("", func(n, p string, nr namedRoute) bool {
+		if n == name {
+			prefix, route, found = p, nr, true
+		}
+		return !found
+	})
+	routesMutex.RUnlock()
+	if !found {
+		return "", fmt.Errorf("shack: route named '%s' is not found", name)
+	}
+
+	values := make(map[string]string, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		values[fmt.Sprint(params[i])] = fmt.Sprint(params[i+1])
+	}
+
+	var b strings.Builder
+	b.WriteString(prefix)
+	for _, segment := range route.segments {
+		if segment.kind == 0 {
+			b.WriteString("/")
+			b.WriteString(segment.value)
+			continue
+		}
+
+		key := segment.value
+		value, ok := values[key]
+		if !ok {
+			return "", fmt.Errorf("shack: param '%s' of route '%s' is missing", key, name)
+		}
+		delete(values, key)
+
+		if segment.kind == _PATH {
+			for _, segment := range strings.Split(strings.TrimPrefix(value, "/"), "/") {
+				b.WriteString("/")
+				b.WriteString(url.PathEscape(segment))
+			}
+			continue
+		}
+		if segment.c != nil && !segment.c.match(value) {
+			return "", fmt.Errorf("shack: param '%s' of route '%s' doesn't match '%s'", key, name, segment.c.expr)
+		}
+		b.WriteString("/")
+		b.WriteString(url.PathEscape(value))
+	}
+
+	for key := range values {
+		return "", fmt.Errorf("shack: param '%s' is not in route '%s'", key, name)
+	}
+	if b.Len() == 0 {
+		return "/", nil
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,165 @@
+package shack
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidEvent is returned by EventStream.Send if the id or type of
+// the event has line breaks, which would inject fields into the stream.
+var ErrInvalidEvent = errors.New("shack: event id and type can't contain line breaks")
+
+// Event is a message pushed to the client through an EventStream.
+type Event struct {
+	// ID sets the event id, which the client sends back in the
+	// Last-Event-ID header when it reconnects.
+	ID string
+	// Event is the event type, "message" is used by the client if empty.
+	Event string
+	// Retry tells the client how long to wait before reconnecting.
+	Retry time.Duration
+	// Data is the payload, string and []byte are written as is,
+	// others are encoded to json.
+	Data interface{}
+}
+
+// EventStream pushes server-sent events to the client.
+type EventStream struct {
+	ctx   *Context
+	w     *streamWriter
+	mutex sync.Mutex
+	// LastEventID is the value of the Last-Event-ID header sent by a
+	// reconnecting client, it can be used to resume the stream.
+	LastEventID string
+}
+
+// EventStream switches the response into streaming mode and
+// returns an EventStream to push server-sent events.
+func (c *Context) EventStream() *EventStream {
+	header := c.Response.ResponseWriter.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+
+	return &EventStream{
+		ctx:         c,
+		w:           c.Response.beginStream(),
+		LastEventID: c.Request.Header("Last-Event-ID"),
+	}
+}
+
+// Send writes an event and flushes it to the client, it returns
+// ErrInvalidEvent if the id or type has `\r` or `\n`.
+func (s *EventStream) Send(e Event) error {
+	if strings.ContainsAny(e.ID, "\r\n") || strings.ContainsAny(e.Event, "\r\n") {
+		return ErrInvalidEvent
+	}
+	data, err := getBytes(e.Data)
+	if err != nil {
+		return err
+	}
+
+	buf := responseBodyPool.Get()
+	defer responseBodyPool.Put(buf)
+	if len(e.ID) > 0 {
+		writeField(buf, "id", e.ID)
+	}
+	if len(e.Event) > 0 {
+		writeField(buf, "event", e.Event)
+	}
+	if e.Retry > 0 {
+		writeField(buf, "retry", strconv.FormatInt(e.Retry.Milliseconds(), 10))
+	}
+	for _, line := range splitLines(string(data)) {
+		writeField(buf, "data", line)
+	}
+	_ = buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+// Comment writes a comment line, which is ignored by the client but
+// keeps the connection alive.
+func (s *EventStream) Comment(text string) error {
+	buf := responseBodyPool.Get()
+	defer responseBodyPool.Put(buf)
+	for _, line := range splitLines(text) {
+		writeField(buf, "", line)
+	}
+	_ = buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+// Heartbeat writes an empty comment every interval until the client
+// goes away or stop is called.
+// stop must be called before the handler returns.
+func (s *EventStream) Heartbeat(interval time.Duration) (stop func()) {
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.Comment("") != nil {
+					return
+				}
+			case <-s.Done():
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			close(quit)
+			<-done
+		})
+	}
+}
+
+// Done returns a channel that's closed when the client disconnects.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.ctx.Request.Context().Done()
+}
+
+func (s *EventStream) write(p []byte) error {
+	if err := s.ctx.Request.Context().Err(); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.w.Write(p); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
+
+// splitLines splits s on `\r\n`, `\r` and `\n`, which are all line
+// breaks of the event stream.
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.Split(s, "\n")
+}
+
+type stringWriter interface {
+	WriteString(s string) (int, error)
+}
+
+func writeField(w stringWriter, name, value string) {
+	_, _ = w.WriteString(name)
+	_, _ = w.WriteString(": ")
+	_, _ = w.WriteString(value)
+	_, _ = w.WriteString("\n")
+}
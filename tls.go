@@ -0,0 +1,173 @@
+package shack
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ichxxx/shack/logger"
+)
+
+// RunTLS is like Run but serves HTTPS with the certificate and key
+// files, which are reloaded once they change on disk, so the rotated
+// certificates are used by the new connections without restarting.
+// The files can be empty if Option.TLSConfig has the certificates.
+func RunTLS(addr, certFile, keyFile string, router *Router, opts ...Option) error {
+	app := NewApp(opts...)
+	app.add(&appListener{
+		network:  "tcp",
+		addr:     addr,
+		ln:       app.opt.Listener,
+		handler:  router,
+		tls:      true,
+		certFile: certFile,
+		keyFile:  keyFile,
+	})
+	return app.run()
+}
+
+// newTLSConfig returns the TLS config of opt, the certificate is got from
+// the returned reloader if the files are given.
+func newTLSConfig(certFile, keyFile string, opt Option) (*tls.Config, *certReloader, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opt.TLSConfig != nil {
+		tlsConfig = opt.TLSConfig.Clone()
+	}
+
+	if len(opt.ClientCAFile) > 0 {
+		pem, err := os.ReadFile(opt.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("shack: no certificate in client CA file '%s'", opt.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		if tlsConfig.ClientAuth == tls.NoClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	if len(certFile) == 0 && len(keyFile) == 0 {
+		if len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil {
+			return nil, nil, errors.New("shack: certificate is missing")
+		}
+		return tlsConfig, nil, nil
+	}
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig.Certificates = nil
+	tlsConfig.GetCertificate = reloader.GetCertificate
+	return tlsConfig, reloader, nil
+}
+
+// certReloader holds the certificate loaded from the files, and reloads
+// it once the files change. The directories of the files are watched
+// rather than the files, so the files replaced by renaming, like the
+// ones rotated by a sidecar or mounted from a Kubernetes secret, are
+// also detected.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mutex    sync.RWMutex
+	cert     *tls.Certificate
+	watcher  *fsnotify.Watcher
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: filepath.Clean(certFile), keyFile: filepath.Clean(keyFile)}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range []string{filepath.Dir(r.certFile), filepath.Dir(r.keyFile)} {
+		if err := watcher.Add(dir); err != nil {
+			_ = watcher.Close()
+			return nil, err
+		}
+	}
+	r.watcher = watcher
+	go r.watch()
+	return r, nil
+}
+
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	r.cert = &cert
+	r.mutex.Unlock()
+	return nil
+}
+
+func (r *certReloader) watch() {
+	for {
+		select {
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if !r.changed(event) {
+				continue
+			}
+			// the certificate and key may be written one by one, the old
+			// certificate is kept until both of them are matched.
+			if err := r.reload(); err != nil {
+				logger.Warn("shack: reload certificate failed", "cert", r.certFile, "err", err)
+				continue
+			}
+			logger.Info("shack: certificate reloaded", "cert", r.certFile)
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Error("shack: watch certificate failed", "cert", r.certFile, "err", err)
+		}
+	}
+}
+
+// changed reports whether the event changes the files, `..data` is the
+// symlink swapped by Kubernetes when a mounted secret is updated.
+func (r *certReloader) changed(event fsnotify.Event) bool {
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	return name == r.certFile || name == r.keyFile || filepath.Base(name) == "..data"
+}
+
+// GetCertificate returns the current certificate, it's used as
+// tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) Close() error {
+	return r.watcher.Close()
+}
+
+// PeerCertificate returns the verified certificate of the client if the
+// request is over mutual TLS, or nil.
+func (c *Context) PeerCertificate() *x509.Certificate {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
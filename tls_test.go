@@ -0,0 +1,151 @@
+package shack
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+func (c *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+}
+
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(certFile, c.certPEM(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestRunTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "server-1", ca)
+	client := newTestCert(t, "client", ca)
+	server.write(t, certFile, keyFile)
+	if err := os.WriteFile(caFile, ca.certPEM(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := freeAddr(t)
+	r := NewRouter()
+	r.GET("/peer", func(ctx *Context) {
+		if cert := ctx.PeerCertificate(); cert != nil {
+			_ = ctx.Response.String(cert.Subject.CommonName)
+		}
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- RunTLS(addr, certFile, keyFile, r, Option{ClientCAFile: caFile})
+	}()
+	waitReady(t, addr)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	serverName := func(certs []tls.Certificate) string {
+		t.Helper()
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      pool,
+			Certificates: certs,
+		}}}
+		defer httpClient.CloseIdleConnections()
+		resp, err := httpClient.Get("https://" + addr + "/peer")
+		if err != nil {
+			return ""
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "client" {
+			t.Fatalf("expect peer client, got %q", body)
+		}
+		return resp.TLS.PeerCertificates[0].Subject.CommonName
+	}
+
+	if name := serverName([]tls.Certificate{client.tlsCertificate()}); name != "server-1" {
+		t.Fatalf("expect server-1, got %q", name)
+	}
+	if name := serverName(nil); len(name) > 0 {
+		t.Fatal("expect the request without client certificate to fail")
+	}
+
+	newTestCert(t, "server-2", ca).write(t, certFile, keyFile)
+	reloaded := false
+	for i := 0; i < 100 && !reloaded; i++ {
+		time.Sleep(10 * time.Millisecond)
+		reloaded = serverName([]tls.Certificate{client.tlsCertificate()}) == "server-2"
+	}
+	if !reloaded {
+		t.Fatal("expect the certificate to be reloaded")
+	}
+
+	if err := Shutdown(addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
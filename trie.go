@@ -3,7 +3,10 @@ package shack
 import (
 	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/ichxxx/shack/utils"
 )
@@ -11,21 +14,64 @@ import (
 const (
 	_PARAM = ':'
 	_PATH  = '*'
-	_WILD  = "*"
 )
 
 var (
-	validPathReg, _    = regexp.Compile(`^\/[:*.\-\w]*(\/[:*.\-\w]+)*$`)
+	validSegmentReg, _ = regexp.Compile(`^([:*.\-\w]+|:[.\-\w]*<.+>)$`)
 	validPatternReg, _ = regexp.Compile(`^\/[\-\w]*(\/[\-\w]+)*$`)
+	uuidReg, _         = regexp.Compile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
 )
 
+// paramConstraints are the typed constraints which can be used like
+// `:id<int>`, others are compiled as regular expressions.
+var paramConstraints = map[string]func(string) bool{
+	"int": func(s string) bool {
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	},
+	"uint": func(s string) bool {
+		_, err := strconv.ParseUint(s, 10, 64)
+		return err == nil
+	},
+	"float": func(s string) bool {
+		_, err := strconv.ParseFloat(s, 64)
+		return err == nil
+	},
+	"alpha": func(s string) bool {
+		for _, r := range s {
+			if !unicode.IsLetter(r) {
+				return false
+			}
+		}
+		return len(s) > 0
+	},
+	"alnum": func(s string) bool {
+		for _, r := range s {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return false
+			}
+		}
+		return len(s) > 0
+	},
+	"uuid": uuidReg.MatchString,
+}
+
 type trie struct {
 	handlers map[string][]Handler
 	isParam  bool
 	isPath   bool
-	childs   map[string]*trie
-	p        string   // p means param or path
-	m        []string // m means the passed methods
+	childs   map[string]*trie // childs are the static childs
+	params   []*trie          // params are the param childs, constrained ones come first
+	path     *trie            // path is the catch-all child
+	p        string           // p means param or path
+	c        *constraint      // c is the constraint of param
+	// bodyLimits are the body limits of routes by method
+	bodyLimits map[string]int64
+}
+
+type constraint struct {
+	expr  string
+	match func(string) bool
 }
 
 func newTrie() *trie {
@@ -35,29 +81,44 @@ func newTrie() *trie {
 	}
 }
 
-func isWild(segment string) bool {
-	if len(segment) == 0 {
+func isValidPath(path string) bool {
+	if path == "/" {
+		return true
+	}
+	if len(path) == 0 || path[0] != '/' {
 		return false
 	}
-	return segment[0] == _PARAM || segment[0] == _PATH
+	for _, segment := range strings.Split(path[1:], "/") {
+		if !validSegmentReg.MatchString(segment) {
+			return false
+		}
+	}
+	return true
 }
 
-func isValidPath(path string) bool {
-	return validPathReg.MatchString(path)
+// parseParam parses a param segment without the leading ':',
+// like `id` or `id<int>`.
+func parseParam(segment string) (name string, c *constraint) {
+	i := strings.IndexByte(segment, '<')
+	if i < 0 {
+		return segment, nil
+	}
+
+	name, expr := segment[:i], segment[i+1:len(segment)-1]
+	if match, ok := paramConstraints[expr]; ok {
+		return name, &constraint{expr: expr, match: match}
+	}
+	reg, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		panic(fmt.Sprintf("shack: constraint '%s' of param '%s' is not valid: %v", expr, name, err))
+	}
+	return name, &constraint{expr: expr, match: reg.MatchString}
 }
 
 func isValidPattern(pattern string) bool {
 	return validPatternReg.MatchString(pattern)
 }
 
-// With adds one or more middlewares for an endpoint handler.
-func (t *trie) With(middleware ...Handler) {
-	// insert from head
-	for _, method := range t.m {
-		t.handlers[method] = append(middleware, t.handlers[method]...)
-	}
-}
-
 func (t *trie) insert(path string, handler Handler, methods ...string) *trie {
 	if !isValidPath(path) {
 		panic(fmt.Sprintf("shack: path '%s' is not valid", path))
@@ -69,108 +130,308 @@ func (t *trie) insert(path string, handler Handler, methods ...string) *trie {
 			continue
 		}
 
-		p := segment
-		if isWild(segment) {
-			segment = _WILD
-		}
-
-		if _, ok := t.childs[segment]; !ok {
-			t.childs[segment] = newTrie()
-		}
-
-		t = t.childs[segment]
-		switch p[0] {
+		switch segment[0] {
 		case _PARAM:
-			t.isParam = true
-			t.p = p[1:]
+			t = t.paramChild(segment[1:], path)
 		case _PATH:
-			t.isPath = true
-			t.p = p[1:]
 			if i != len(segments)-1 {
 				panic(fmt.Sprintf("shack: '*' can only use in the last in path '%s'", path))
 			}
+			if t.path == nil {
+				t.path = newTrie()
+				t.path.isPath = true
+				t.path.p = segment[1:]
+			} else if t.path.p != segment[1:] {
+				panic(fmt.Sprintf("shack: path '%s' conflicts with '%s' in path '%s'", segment[1:], t.path.p, path))
+			}
+			t = t.path
+		default:
+			if _, ok := t.childs[segment]; !ok {
+				t.childs[segment] = newTrie()
+			}
+			t = t.childs[segment]
 		}
 	}
 
 	if handler != nil {
 		for _, method := range methods {
-			switch method {
-			case _ALL:
-				if len(t.handlers) > 0 {
-					panic("shack: can't route method 'ALL', method duplicated")
-				}
-			default:
-				if t.handlers[_ALL] != nil || t.handlers[method] != nil {
-					panic(fmt.Sprintf("shack: can't route method '%s', method duplicated", method))
-				}
-			}
-			t.m = methods
-			t.handlers[method] = append(t.handlers[method], handler)
+			t.setHandlers(method, []Handler{handler}, path)
 		}
 	}
 
 	return t
 }
 
-func (t *trie) search(method, path []byte) (handlers []Handler, params map[string]string, ok bool) {
-	i := 1
-	var splitPos int
-	for ; i < len(path); i++ {
-		if path[i] == '/' {
-			next := t.next(utils.UnsafeString(path[splitPos+1 : i]))
-			if next == nil {
-				return
-			}
+// setHandlers sets the handlers of method, it panics if the method is
+// already routed.
+func (t *trie) setHandlers(method string, handlers []Handler, path string) {
+	switch method {
+	case _ALL:
+		if len(t.handlers) > 0 {
+			panic(fmt.Sprintf("shack: can't route method 'ALL' in path '%s', method duplicated", path))
+		}
+	default:
+		if t.handlers[_ALL] != nil || t.handlers[method] != nil {
+			panic(fmt.Sprintf("shack: can't route method '%s' in path '%s', method duplicated", method, path))
+		}
+	}
+	t.handlers[method] = handlers
+}
 
-			t = next
-			if t.isPath {
-				if params == nil {
-					params = make(map[string]string)
-				}
-				params[t.p] = utils.UnsafeString(path[splitPos:])
-				break
-			}
+// paramChild returns the param child for segment, a new one is added
+// if there isn't a child with the same constraint.
+func (t *trie) paramChild(segment, path string) *trie {
+	name, c := parseParam(segment)
+	if child := t.findParam(c); child != nil {
+		if child.p != name {
+			panic(fmt.Sprintf("shack: param '%s' conflicts with '%s' in path '%s'", name, child.p, path))
+		}
+		return child
+	}
 
-			if t.isParam {
-				if params == nil {
-					params = make(map[string]string)
-				}
-				params[t.p] = utils.UnsafeString(path[splitPos+1 : i])
-			}
+	child := newTrie()
+	child.isParam = true
+	child.p = name
+	child.c = c
+	t.addParam(child)
+	return child
+}
+
+// addParam adds a param child, the constrained ones are matched first
+// in the order they are added, and the unconstrained one is the last.
+func (t *trie) addParam(child *trie) {
+	i := len(t.params)
+	if child.c != nil {
+		for i > 0 && t.params[i-1].c == nil {
+			i--
+		}
+	}
+	t.params = append(t.params, nil)
+	copy(t.params[i+1:], t.params[i:])
+	t.params[i] = child
+}
+
+func (c *constraint) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.expr
+}
+
+// findParam returns the param child with the same constraint as c.
+func (t *trie) findParam(c *constraint) *trie {
+	for _, child := range t.params {
+		if child.c.String() == c.String() {
+			return child
+		}
+	}
+	return nil
+}
+
+func (t *trie) setBodyLimit(method string, limit int64) {
+	if t.bodyLimits == nil {
+		t.bodyLimits = make(map[string]int64)
+	}
+	t.bodyLimits[method] = limit
+}
+
+// clone returns a copy of t and its descendants, the handler slices are
+// shared since they're replaced rather than modified.
+func (t *trie) clone() *trie {
+	c := *t
+	c.handlers = make(map[string][]Handler, len(t.handlers))
+	for method, handlers := range t.handlers {
+		c.handlers[method] = handlers
+	}
+	c.childs = make(map[string]*trie, len(t.childs))
+	for key, child := range t.childs {
+		c.childs[key] = child.clone()
+	}
+	c.params = make([]*trie, len(t.params))
+	for i, child := range t.params {
+		c.params[i] = child.clone()
+	}
+	if t.path != nil {
+		c.path = t.path.clone()
+	}
+	return &c
+}
 
-			splitPos = i
+// prepend prepends middlewares to the handlers of t and its descendants,
+// except the static childs of the sub routers in skip.
+func (t *trie) prepend(middlewares []Handler, skip map[string]*Router) {
+	if len(middlewares) == 0 {
+		return
+	}
+	for method, handlers := range t.handlers {
+		t.handlers[method] = joinHandlers(middlewares, handlers...)
+	}
+	for key, child := range t.childs {
+		if skip[key] == nil {
+			child.prepend(middlewares, nil)
 		}
 	}
+	for _, child := range t.params {
+		child.prepend(middlewares, nil)
+	}
+	if t.path != nil {
+		t.path.prepend(middlewares, nil)
+	}
+}
 
-	if i > 1 && !t.isPath {
-		next := t.next(utils.UnsafeString(path[splitPos+1 : i]))
+// merge merges the handlers and childs of sub into t, path is the pattern
+// of t used in the panic messages. It panics on the conflicts like insert.
+func (t *trie) merge(sub *trie, path string) {
+	for method, handlers := range sub.handlers {
+		t.setHandlers(method, handlers, path)
+	}
+	for method, limit := range sub.bodyLimits {
+		t.setBodyLimit(method, limit)
+	}
+	for key, child := range sub.childs {
+		if next, ok := t.childs[key]; ok {
+			next.merge(child, path+"/"+key)
+		} else {
+			t.childs[key] = child
+		}
+	}
+	for _, child := range sub.params {
+		next := t.findParam(child.c)
 		if next == nil {
-			return
+			t.addParam(child)
+			continue
+		}
+		if next.p != child.p {
+			panic(fmt.Sprintf("shack: param '%s' conflicts with '%s' in path '%s'", child.p, next.p, path))
+		}
+		next.merge(child, path+"/:"+child.p)
+	}
+	if sub.path != nil {
+		if t.path == nil {
+			t.path = sub.path
+		} else if t.path.p != sub.path.p {
+			panic(fmt.Sprintf("shack: path '%s' conflicts with '%s' in path '%s'", sub.path.p, t.path.p, path))
+		} else {
+			t.path.merge(sub.path, path+"/*"+sub.path.p)
+		}
+	}
+}
+
+// search finds the node matching path, static childs take priority
+// over param childs, which take priority over the catch-all child,
+// and it backtracks if a branch dead-ends.
+// If no node has handlers for the method, the first matched node
+// having handlers for other methods is returned with nil handlers.
+func (t *trie) search(method, path []byte) (node *trie, handlers []Handler, params map[string]string) {
+	m := &matcher{method: utils.UnsafeString(method), path: utils.UnsafeString(path)}
+	start := 0
+	if m.path == "/" {
+		start = len(m.path)
+	}
+
+	if found := m.match(t, start); found != nil {
+		return found, found.methodHandlers(m.method), m.params
+	}
+	return m.fallback, nil, m.fallbackParams
+}
+
+func (t *trie) methodHandlers(method string) []Handler {
+	if handlers := t.handlers[method]; handlers != nil {
+		return handlers
+	}
+	return t.handlers[_ALL]
+}
+
+// allow returns the value of Allow header for the methods routed on t.
+func (t *trie) allow() string {
+	if t.handlers[_ALL] != nil {
+		return allMethods
+	}
+
+	methods := make([]string, 0, len(t.handlers)+2)
+	for method := range t.handlers {
+		methods = append(methods, method)
+	}
+	if t.handlers[_GET] != nil && t.handlers[_HEAD] == nil {
+		methods = append(methods, _HEAD)
+	}
+	if t.handlers[_OPTIONS] == nil {
+		methods = append(methods, _OPTIONS)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+type matcher struct {
+	method         string
+	path           string
+	params         map[string]string
+	fallback       *trie
+	fallbackParams map[string]string
+}
+
+// match matches the path from start, which is the position of a '/'
+// or the end of path.
+func (m *matcher) match(t *trie, start int) *trie {
+	if start >= len(m.path) {
+		return m.matchEnd(t)
+	}
+
+	end := strings.IndexByte(m.path[start+1:], '/')
+	if end < 0 {
+		end = len(m.path)
+	} else {
+		end += start + 1
+	}
+	segment := m.path[start+1 : end]
+
+	if next := t.childs[segment]; next != nil {
+		if found := m.match(next, end); found != nil {
+			return found
 		}
-		t = next
 	}
 
-	if t.isParam {
-		if params == nil {
-			params = make(map[string]string)
+	for _, next := range t.params {
+		if next.c == nil || next.c.match(segment) {
+			m.setParam(next.p, segment)
+			if found := m.match(next, end); found != nil {
+				return found
+			}
+			delete(m.params, next.p)
 		}
-		params[t.p] = utils.UnsafeString(path[splitPos+1 : i])
 	}
 
-	handlers = t.handlers[utils.UnsafeString(method)]
-	if handlers == nil {
-		handlers = t.handlers[_ALL]
+	if t.path != nil {
+		m.setParam(t.path.p, m.path[start:])
+		if found := m.matchEnd(t.path); found != nil {
+			return found
+		}
+		delete(m.params, t.path.p)
 	}
-	ok = true
-	return
+	return nil
 }
 
-func (t *trie) next(segment string) (next *trie) {
-	next = t.childs[segment]
-	if next == nil {
-		next = t.childs[_WILD]
+func (m *matcher) matchEnd(t *trie) *trie {
+	if t.methodHandlers(m.method) != nil {
+		return t
+	}
+	if m.fallback == nil && len(t.handlers) > 0 {
+		m.fallback = t
+		if len(m.params) > 0 {
+			m.fallbackParams = make(map[string]string, len(m.params))
+			for k, v := range m.params {
+				m.fallbackParams[k] = v
+			}
+		}
 	}
-	return
+	return nil
+}
+
+func (m *matcher) setParam(key, value string) {
+	if m.params == nil {
+		m.params = make(map[string]string)
+	}
+	m.params[key] = value
 }
 
 func (t *trie) print() {
@@ -182,4 +443,11 @@ func (t *trie) dfsPrint(count int) {
 		fmt.Println(strings.Repeat("-", count), key)
 		child.dfsPrint(count + 1)
 	}
+	for _, child := range t.params {
+		fmt.Println(strings.Repeat("-", count), ":"+child.p, child.c.String())
+		child.dfsPrint(count + 1)
+	}
+	if t.path != nil {
+		fmt.Println(strings.Repeat("-", count), "*"+t.path.p)
+	}
 }
@@ -9,6 +9,10 @@ func TestTrie(t *testing.T) {
 	normalHandler := Handler(func(*Context) {})
 	wildHandler := Handler(func(*Context) {})
 	pathHandler := Handler(func(*Context) {})
+	staticHandler := Handler(func(*Context) {})
+	quxHandler := Handler(func(*Context) {})
+	paramHandler := Handler(func(*Context) {})
+	restHandler := Handler(func(*Context) {})
 	inputs := []struct {
 		method  string
 		pattern string
@@ -20,6 +24,12 @@ func TestTrie(t *testing.T) {
 		{_GET, "/bar/*path", pathHandler},
 		{_GET, "/*path", pathHandler},
 		{_ALL, "/foo/bar/all", normalHandler},
+		{_GET, "/foo/bar/baz", staticHandler},
+		{_GET, "/foo/:var/qux", quxHandler},
+		{_GET, "/a/:x", paramHandler},
+		{_GET, "/a/*rest", restHandler},
+		{_POST, "/b/:x/c", paramHandler},
+		{_POST, "/b/*rest", restHandler},
 	}
 
 	tests := []struct {
@@ -35,13 +45,24 @@ func TestTrie(t *testing.T) {
 		{_GET, "/foo/bar", true, normalHandler, "", ""},
 		{_GET, "/bar/f/o/o", true, pathHandler, "path", "/f/o/o"},
 		{_GET, "/f/o/bar.html", true, pathHandler, "path", "/f/o/bar.html"},
-		{_GET, "/foo/test", true, nil, "var", "test"},
-		{_GET, "/foo/test/foo", false, nil, "var", "test"},
-		{_GET, "/foo/bar/foo", false, nil, "", ""},
+		{_GET, "/foo/test", true, pathHandler, "path", "/foo/test"},
+		{_GET, "/foo/test/foo", true, pathHandler, "path", "/foo/test/foo"},
+		{_GET, "/foo/bar/foo", true, pathHandler, "path", "/foo/bar/foo"},
 		{_POST, "/foo/test/bar", true, nil, "var", "test"},
-		{_POST, "/foo/bar/foo", false, nil, "", ""},
+		{_POST, "/foo/bar/foo", true, nil, "path", "/foo/bar/foo"},
 		{_POST, "/foo/bar/all", true, normalHandler, "", ""},
 		{_DELETE, "/foo/bar/all", true, normalHandler, "", ""},
+		// static > param > catch-all with backtracking
+		{_GET, "/foo/bar/baz", true, staticHandler, "", ""},
+		{_GET, "/foo/bar/qux", true, quxHandler, "var", "bar"},
+		{_GET, "/foo/bar/bar", true, wildHandler, "var", "bar"},
+		{_GET, "/a/b", true, paramHandler, "x", "b"},
+		{_GET, "/a/b/c", true, restHandler, "rest", "/b/c"},
+		{_GET, "/a/b/c", true, restHandler, "x", ""},
+		{_POST, "/b/x/c", true, paramHandler, "x", "x"},
+		{_POST, "/b/x/d", true, restHandler, "rest", "/x/d"},
+		{_POST, "/b/x/d", true, restHandler, "x", ""},
+		{_POST, "/c", true, nil, "path", "/c"},
 	}
 
 	trie := newTrie()
@@ -50,7 +71,8 @@ func TestTrie(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		handlers, param, ok := trie.search([]byte(test.method), []byte(test.path))
+		node, handlers, param := trie.search([]byte(test.method), []byte(test.path))
+		ok := node != nil
 		if handler := firstHandler(handlers); fmt.Sprintf("%v", handler) != fmt.Sprintf("%v", test.handler) {
 			t.Errorf("input [%d]: expecting handler:%v, got:%v", i, test.handler, handler)
 		}
@@ -69,3 +91,70 @@ func firstHandler(handlers []Handler) Handler {
 	}
 	return nil
 }
+
+func TestTrieConstraint(t *testing.T) {
+	intHandler := Handler(func(*Context) {})
+	uuidHandler := Handler(func(*Context) {})
+	regHandler := Handler(func(*Context) {})
+	nameHandler := Handler(func(*Context) {})
+	inputs := []struct {
+		method  string
+		pattern string
+		handler Handler
+	}{
+		{_GET, "/users/:id<int>", intHandler},
+		{_GET, "/users/:name", nameHandler},
+		{_GET, "/users/:uuid<uuid>", uuidHandler},
+		{_GET, "/files/:name<[a-z]+\\.png>", regHandler},
+	}
+
+	tests := []struct {
+		method  string
+		path    string
+		ok      bool
+		handler Handler
+		pKey    string
+		pValue  string
+	}{
+		{_GET, "/users/42", true, intHandler, "id", "42"},
+		{_GET, "/users/-7", true, intHandler, "id", "-7"},
+		{_GET, "/users/foo", true, nameHandler, "name", "foo"},
+		{_GET, "/users/0b0f1a6e-1d3c-4c4b-9a57-3c1f2e9d8a10", true, uuidHandler, "uuid", "0b0f1a6e-1d3c-4c4b-9a57-3c1f2e9d8a10"},
+		{_GET, "/files/foo.png", true, regHandler, "name", "foo.png"},
+		{_GET, "/files/foo.jpg", false, nil, "", ""},
+		{_GET, "/files/Foo.png", false, nil, "", ""},
+	}
+
+	trie := newTrie()
+	for _, input := range inputs {
+		trie.insert(input.pattern, input.handler, input.method)
+	}
+
+	for i, test := range tests {
+		node, handlers, param := trie.search([]byte(test.method), []byte(test.path))
+		ok := node != nil
+		if handler := firstHandler(handlers); fmt.Sprintf("%v", handler) != fmt.Sprintf("%v", test.handler) {
+			t.Errorf("input [%d]: expecting handler:%v, got:%v", i, test.handler, handler)
+		}
+		if param[test.pKey] != test.pValue {
+			t.Errorf("input [%d]: expecting param %s:%s, got:%s", i, test.pKey, test.pValue, param[test.pKey])
+		}
+		if ok != test.ok {
+			t.Errorf("input [%d]: expecting ok:%v, got:%v", i, test.ok, ok)
+		}
+	}
+}
+
+func TestTrieInvalidPath(t *testing.T) {
+	paths := []string{"/users/:id<[0-9]+", "/users/:id<(>", "/foo/*path/bar", "foo"}
+	for i, path := range paths {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("input [%d]: expecting panic for path '%s'", i, path)
+				}
+			}()
+			newTrie().insert(path, func(*Context) {}, _GET)
+		}()
+	}
+}
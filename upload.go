@@ -0,0 +1,297 @@
+package shack
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+var (
+	// ErrMissingFile means there isn't a file of the key in the form.
+	ErrMissingFile = errors.New("file is missing")
+	// ErrFileTooLarge means a file exceeds FileLimit.MaxSize.
+	ErrFileTooLarge = errors.New("file is too large")
+	// ErrTooManyFiles means the count of files exceeds FileLimit.MaxCount.
+	ErrTooManyFiles = errors.New("too many files")
+	// ErrFileType means the extension or the sniffed content type of
+	// a file is not allowed.
+	ErrFileType = errors.New("file type is not allowed")
+
+	fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+)
+
+// sniffLen is the length of content used to detect the content type.
+const sniffLen = 512
+
+// FileLimit limits the uploaded files, the zero values mean no limit.
+type FileLimit struct {
+	// MaxSize is the max size in bytes of each file.
+	MaxSize int64
+	// MaxCount is the max count of files, of a key for Context.FormFiles,
+	// or of the whole form for Context.MultipartReader.
+	MaxCount int
+	// Extensions are the allowed file extensions like `.png`, which
+	// are compared case-insensitively.
+	Extensions []string
+	// MIMETypes are the allowed content types detected from the file
+	// content by http.DetectContentType, like `image/png`.
+	MIMETypes []string
+}
+
+func (l *FileLimit) checkCount(count int) error {
+	if l.MaxCount > 0 && count > l.MaxCount {
+		return ErrTooManyFiles
+	}
+	return nil
+}
+
+func (l *FileLimit) checkSize(size int64) error {
+	if l.MaxSize > 0 && size > l.MaxSize {
+		return ErrFileTooLarge
+	}
+	return nil
+}
+
+func (l *FileLimit) checkExtension(filename string) error {
+	if len(l.Extensions) == 0 {
+		return nil
+	}
+	ext := filepath.Ext(filename)
+	for _, allowed := range l.Extensions {
+		if strings.EqualFold(ext, allowed) {
+			return nil
+		}
+	}
+	return ErrFileType
+}
+
+func (l *FileLimit) checkContent(head []byte) error {
+	if len(l.MIMETypes) == 0 {
+		return nil
+	}
+	contentType := http.DetectContentType(head)
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	for _, allowed := range l.MIMETypes {
+		if strings.EqualFold(contentType, allowed) {
+			return nil
+		}
+	}
+	return ErrFileType
+}
+
+// check checks the size, extension and content of the file.
+func (l *FileLimit) check(file *multipart.FileHeader) error {
+	if err := l.checkSize(file.Size); err != nil {
+		return err
+	}
+	if err := l.checkExtension(file.Filename); err != nil {
+		return err
+	}
+	if len(l.MIMETypes) == 0 {
+		return nil
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	return l.checkContent(head[:n])
+}
+
+// FormFile returns the first file of the key in the multipart form,
+// checked by the limit if given. The error is also set to the context.
+func (c *Context) FormFile(key string, limit ...FileLimit) (*multipart.FileHeader, error) {
+	files, err := c.FormFiles(key, limit...)
+	if err != nil {
+		return nil, err
+	}
+	return files[0], nil
+}
+
+// FormFiles returns the files of the key in the multipart form, checked
+// by the limit if given. The error is also set to the context.
+func (c *Context) FormFiles(key string, limit ...FileLimit) ([]*multipart.FileHeader, error) {
+	if err := c.Request.parseMultipartForm(); err != nil {
+		return nil, err
+	}
+	var files []*multipart.FileHeader
+	if c.Request.MultipartForm != nil {
+		files = c.Request.MultipartForm.File[key]
+	}
+	if len(files) == 0 {
+		return nil, c.paramError(SourceForm, key, "", ErrMissingFile)
+	}
+	if len(limit) == 0 {
+		return files, nil
+	}
+
+	if err := limit[0].checkCount(len(files)); err != nil {
+		return nil, c.paramError(SourceForm, key, "", err)
+	}
+	for _, file := range files {
+		if err := limit[0].check(file); err != nil {
+			return nil, c.paramError(SourceForm, key, file.Filename, err)
+		}
+	}
+	return files, nil
+}
+
+// SaveFile saves the first file of the key in the multipart form to
+// the path dst, the directories of dst are created if not exist.
+// The error is also set to the context.
+func (c *Context) SaveFile(key, dst string, limit ...FileLimit) error {
+	file, err := c.FormFile(key, limit...)
+	if err != nil {
+		return err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.Error(err)
+		return err
+	}
+	defer src.Close()
+
+	_, err = saveTo(dst, src)
+	c.Error(err)
+	return err
+}
+
+func saveTo(dst string, src io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, src)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// MultipartReader reads the parts of multipart form one by one while the
+// body is being received, so the parts are never buffered in memory or
+// on disk. It's the way to handle very large uploads.
+type MultipartReader struct {
+	reader *multipart.Reader
+	limit  FileLimit
+	count  int
+}
+
+// MultipartReader returns a MultipartReader of the request, the files
+// are checked by the limit if given. It can't be used with the other
+// ways reading the form, like Context.Form, FormFile or Bind.
+func (c *Context) MultipartReader(limit ...FileLimit) (*MultipartReader, error) {
+	reader, err := c.Request.Request.MultipartReader()
+	if err != nil {
+		c.Error(err)
+		return nil, err
+	}
+
+	r := &MultipartReader{reader: reader}
+	if len(limit) > 0 {
+		r.limit = limit[0]
+	}
+	return r, nil
+}
+
+// NextPart returns the next part, or io.EOF if there are no more parts.
+// The file parts are checked by the limit, and reading a file part
+// fails with ErrFileTooLarge once it exceeds the max size.
+func (r *MultipartReader) NextPart() (*Part, error) {
+	part, err := r.reader.NextPart()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Part{Part: part, reader: part}
+	if len(part.FileName()) == 0 {
+		return p, nil
+	}
+
+	p.limit = r.limit.MaxSize
+	r.count++
+	if err := r.limit.checkCount(r.count); err != nil {
+		return nil, r.partError(part, err)
+	}
+	if err := r.limit.checkExtension(part.FileName()); err != nil {
+		return nil, r.partError(part, err)
+	}
+	if len(r.limit.MIMETypes) > 0 {
+		br := bufio.NewReaderSize(part, sniffLen)
+		head, err := br.Peek(sniffLen)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err := r.limit.checkContent(head); err != nil {
+			return nil, r.partError(part, err)
+		}
+		p.reader = br
+	}
+	return p, nil
+}
+
+func (r *MultipartReader) partError(part *multipart.Part, err error) error {
+	return &ParamError{Source: SourceForm, Key: part.FormName(), Value: part.FileName(), Err: err}
+}
+
+// Part is a part of multipart form read by MultipartReader.
+type Part struct {
+	*multipart.Part
+	reader io.Reader
+	limit  int64
+	read   int64
+}
+
+// Read reads the content of the part, it fails with ErrFileTooLarge
+// once the content exceeds the max size of FileLimit.
+func (p *Part) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	p.read += int64(n)
+	if p.limit > 0 && p.read > p.limit {
+		return n, &ParamError{Source: SourceForm, Key: p.FormName(), Value: p.FileName(), Err: ErrFileTooLarge}
+	}
+	return n, err
+}
+
+// SaveTo saves the content of the part to the path dst, the directories
+// of dst are created if not exist. The partially written file is
+// removed if it fails.
+func (p *Part) SaveTo(dst string) (int64, error) {
+	n, err := saveTo(dst, p)
+	if err != nil {
+		_ = os.Remove(dst)
+	}
+	return n, err
+}
+
+func isFileType(t reflect.Type) bool {
+	return t == fileHeaderType || (t.Kind() == reflect.Slice && t.Elem() == fileHeaderType)
+}
+
+// setFiles sets the file field rv, which is *multipart.FileHeader or
+// []*multipart.FileHeader.
+func setFiles(rv reflect.Value, files []*multipart.FileHeader) {
+	if rv.Kind() == reflect.Slice {
+		rv.Set(reflect.ValueOf(files))
+		return
+	}
+	rv.Set(reflect.ValueOf(files[0]))
+}
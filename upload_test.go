@@ -0,0 +1,169 @@
+package shack
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\x0D\x0A\x1A\x0A")
+
+func newMultipartRequest(t *testing.T, fields map[string]string, files ...[3]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		_ = w.WriteField(k, v)
+	}
+	for _, file := range files {
+		fw, err := w.CreateFormFile(file[0], file[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = fw.Write([]byte(file[2]))
+	}
+	_ = w.Close()
+
+	req := httptest.NewRequest(_POST, "/", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestFormFiles(t *testing.T) {
+	dir := t.TempDir()
+	png := string(pngHeader) + "image"
+
+	var err error
+	var files []*multipart.FileHeader
+	r := NewRouter()
+	r.POST("/", func(ctx *Context) {
+		files, err = ctx.FormFiles("file", FileLimit{
+			MaxSize:    16,
+			MaxCount:   2,
+			Extensions: []string{".png"},
+			MIMETypes:  []string{"image/png"},
+		})
+	})
+	r.POST("/save", func(ctx *Context) {
+		err = ctx.SaveFile("file", filepath.Join(dir, "sub", "saved.txt"))
+	})
+
+	tests := []struct {
+		files    [][3]string
+		expected error
+	}{
+		{[][3]string{{"file", "a.png", png}, {"file", "b.PNG", png}}, nil},
+		{[][3]string{{"other", "a.png", png}}, ErrMissingFile},
+		{[][3]string{{"file", "a.png", png}, {"file", "b.png", png}, {"file", "c.png", png}}, ErrTooManyFiles},
+		{[][3]string{{"file", "a.png", png + strings.Repeat("x", 16)}}, ErrFileTooLarge},
+		{[][3]string{{"file", "a.txt", png}}, ErrFileType},
+		{[][3]string{{"file", "a.png", "not a png"}}, ErrFileType},
+	}
+	for i, test := range tests {
+		err, files = nil, nil
+		r.ServeHTTP(httptest.NewRecorder(), newMultipartRequest(t, nil, test.files...))
+		if !errors.Is(err, test.expected) {
+			t.Errorf("test %d: expected %v, got %v", i, test.expected, err)
+		}
+		if test.expected == nil && len(files) != len(test.files) {
+			t.Errorf("test %d: expected %d files, got %d", i, len(test.files), len(files))
+		}
+	}
+
+	req := newMultipartRequest(t, nil, [3]string{"file", "a.txt", "hello"})
+	req.URL.Path = "/save"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "sub", "saved.txt")); string(b) != "hello" {
+		t.Errorf("unexpected saved file %q", b)
+	}
+}
+
+func TestMultipartReader(t *testing.T) {
+	dir := t.TempDir()
+	var names []string
+	var errs []error
+	r := NewRouter()
+	r.POST("/", func(ctx *Context) {
+		reader, err := ctx.MultipartReader(FileLimit{MaxSize: 8, Extensions: []string{".txt"}})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			if len(part.FileName()) == 0 {
+				names = append(names, part.FormName())
+				continue
+			}
+			names = append(names, part.FileName())
+			if _, err := part.SaveTo(filepath.Join(dir, part.FileName())); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	})
+
+	req := newMultipartRequest(t, map[string]string{"name": "foo"},
+		[3]string{"file", "a.txt", "small"},
+		[3]string{"file", "b.txt", "too large file"},
+		[3]string{"file", "c.png", "png"},
+	)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if strings.Join(names, ",") != "name,a.txt,b.txt" {
+		t.Errorf("unexpected parts %v", names)
+	}
+	if len(errs) != 2 || !errors.Is(errs[0], ErrFileTooLarge) || !errors.Is(errs[1], ErrFileType) {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(b) != "small" {
+		t.Errorf("unexpected saved file %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.txt")); !os.IsNotExist(err) {
+		t.Error("partially written file should be removed")
+	}
+}
+
+func TestBindFiles(t *testing.T) {
+	type upload struct {
+		Name   string                  `form:"name"`
+		Avatar *multipart.FileHeader   `form:"avatar"`
+		Photos []*multipart.FileHeader `form:"photos"`
+	}
+
+	var got upload
+	r := NewRouter()
+	r.POST("/", func(ctx *Context) {
+		if err := ctx.Bind(&got); err != nil {
+			t.Error(err)
+		}
+	})
+
+	req := newMultipartRequest(t, map[string]string{"name": "foo"},
+		[3]string{"avatar", "a.png", "a"},
+		[3]string{"photos", "b.png", "b"},
+		[3]string{"photos", "c.png", "c"},
+	)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.Name != "foo" || got.Avatar == nil || got.Avatar.Filename != "a.png" ||
+		len(got.Photos) != 2 || got.Photos[1].Filename != "c.png" {
+		t.Errorf("unexpected %+v", got)
+	}
+}
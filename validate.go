@@ -0,0 +1,341 @@
+package shack
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidationFunc reports whether v is valid for a rule, param is the text
+// after '=' in the rule, like `1` of `min=1`.
+type ValidationFunc func(v reflect.Value, param string) bool
+
+// validations are the rules which can be used in `validate` tag.
+var validations = map[string]ValidationFunc{
+	"required": func(v reflect.Value, _ string) bool {
+		return !isEmptyValue(v)
+	},
+	"min": func(v reflect.Value, param string) bool {
+		n, ok := sizeOf(v)
+		return ok && n >= ruleNumber(param)
+	},
+	"max": func(v reflect.Value, param string) bool {
+		n, ok := sizeOf(v)
+		return ok && n <= ruleNumber(param)
+	},
+	"len": func(v reflect.Value, param string) bool {
+		n, ok := sizeOf(v)
+		return ok && n == ruleNumber(param)
+	},
+	"email": func(v reflect.Value, _ string) bool {
+		v, ok := indirect(v)
+		if !ok || v.Kind() != reflect.String {
+			return false
+		}
+		addr, err := mail.ParseAddress(v.String())
+		return err == nil && addr.Address == v.String()
+	},
+	"oneof": func(v reflect.Value, param string) bool {
+		v, ok := indirect(v)
+		if !ok {
+			return false
+		}
+		s := fmt.Sprint(v.Interface())
+		for _, option := range strings.Fields(param) {
+			if s == option {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// numericRules are the builtin rules whose params must be numbers.
+var numericRules = map[string]bool{"min": true, "max": true, "len": true}
+
+// RegisterValidation registers a custom rule which can be used in
+// `validate` tag like the builtin ones, it should be called before serving.
+func RegisterValidation(rule string, fn ValidationFunc) {
+	if len(rule) == 0 || fn == nil {
+		panic("shack: validation rule and func can't be empty")
+	}
+	validations[rule] = fn
+	delete(numericRules, rule)
+}
+
+// ValidationError describes a field failing on a rule.
+type ValidationError struct {
+	// Field is the path of the struct field, like `Items[0].Name`.
+	Field string
+	Rule  string
+	Param string
+	Value interface{}
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("field '%s' %s", e.Field, e.Message())
+}
+
+// Message returns the message of the failed rule, like `is required`.
+func (e *ValidationError) Message() string {
+	switch e.Rule {
+	case "required":
+		return "is required"
+	case "min":
+		return "must be at least " + e.Param
+	case "max":
+		return "must be at most " + e.Param
+	case "len":
+		return "must have length " + e.Param
+	case "email":
+		return "must be a valid email"
+	case "oneof":
+		return "must be one of " + e.Param
+	}
+	if len(e.Param) > 0 {
+		return fmt.Sprintf("failed on rule '%s=%s'", e.Rule, e.Param)
+	}
+	return fmt.Sprintf("failed on rule '%s'", e.Rule)
+}
+
+// ValidationErrors is returned by Validate if any field is not valid.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return "shack: validation failed: " + strings.Join(messages, "; ")
+}
+
+// Map returns the messages keyed by the field paths.
+func (e ValidationErrors) Map() map[string]string {
+	m := make(map[string]string, len(e))
+	for _, err := range e {
+		m[err.Field] = err.Message()
+	}
+	return m
+}
+
+// Validate validates the fields of struct v by the rules in `validate` tag,
+// like `validate:"required,min=1,max=100"`. The fields of nested structs
+// are validated by their own tags, and the rules after `dive` apply to
+// the elements of slices and maps. Fields are optional with `omitempty`.
+// It returns ValidationErrors if any field is not valid.
+func Validate(v interface{}) error {
+	rv, ok := indirect(reflect.ValueOf(v))
+	if !ok || rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs ValidationErrors
+	validateStruct(rv, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validationField is the validation metadata of a field, which is
+// built once for each type.
+type validationField struct {
+	index []int
+	name  string
+	rules []validationRule
+}
+
+type validationRule struct {
+	name  string
+	param string
+	fn    ValidationFunc
+}
+
+// validationFieldsCache caches the []*validationField by reflect.Type.
+var validationFieldsCache sync.Map
+
+func validationFieldsOf(t reflect.Type) []*validationField {
+	if fields, ok := validationFieldsCache.Load(t); ok {
+		return fields.([]*validationField)
+	}
+
+	var fields []*validationField
+	walkStruct(t, "", nil, func(field reflect.StructField, _ string, index []int) {
+		tag := field.Tag.Get("validate")
+		if tag == "-" {
+			return
+		}
+
+		f := &validationField{index: index, name: field.Name}
+		if len(tag) > 0 {
+			// ft is the type the rules apply to, it's the element type
+			// after dive, or nil if it's only known at runtime.
+			ft := field.Type
+			for _, rule := range strings.Split(tag, ",") {
+				r := parseValidationRule(t, field.Name, rule)
+				if r.name == "dive" {
+					ft = diveType(t, field.Name, ft)
+				}
+				f.rules = append(f.rules, r)
+			}
+		}
+		fields = append(fields, f)
+	})
+
+	actual, _ := validationFieldsCache.LoadOrStore(t, fields)
+	return actual.([]*validationField)
+}
+
+// parseValidationRule parses a rule of the field of t, it panics if the
+// rule isn't registered or its param isn't valid, so a bad tag fails
+// once the type is first validated rather than on each value.
+func parseValidationRule(t reflect.Type, field, rule string) validationRule {
+	name, param := rule, ""
+	if i := strings.IndexByte(rule, '='); i >= 0 {
+		name, param = rule[:i], rule[i+1:]
+	}
+	if name == "dive" || name == "omitempty" {
+		return validationRule{name: name}
+	}
+
+	fn, ok := validations[name]
+	if !ok {
+		panic(fmt.Sprintf("shack: validation rule '%s' of field '%s.%s' is not registered", name, t, field))
+	}
+	if numericRules[name] {
+		if _, err := strconv.ParseFloat(param, 64); err != nil {
+			panic(fmt.Sprintf("shack: param '%s' of validation rule '%s' of field '%s.%s' is not a number", param, name, t, field))
+		}
+	}
+	return validationRule{name: name, param: param, fn: fn}
+}
+
+// diveType returns the element type of ft for dive, it panics if ft
+// isn't a slice, array or map.
+func diveType(t reflect.Type, field string, ft reflect.Type) reflect.Type {
+	for ft != nil && ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	if ft == nil || ft.Kind() == reflect.Interface {
+		return nil
+	}
+	switch ft.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return ft.Elem()
+	}
+	panic(fmt.Sprintf("shack: can't dive into field '%s.%s' of type %s", t, field, ft))
+}
+
+func validateStruct(rv reflect.Value, prefix string, errs *ValidationErrors) {
+	for _, field := range validationFieldsOf(rv.Type()) {
+		validateValue(rv.FieldByIndex(field.index), prefix+field.name, field.rules, errs)
+	}
+}
+
+// validateValue validates rv by the rules, only the first failed rule
+// of a value is reported.
+func validateValue(rv reflect.Value, path string, rules []validationRule, errs *ValidationErrors) {
+	for i, rule := range rules {
+		switch rule.name {
+		case "dive":
+			dive(rv, path, rules[i+1:], errs)
+			return
+		case "omitempty":
+			if isEmptyValue(rv) {
+				return
+			}
+			continue
+		}
+
+		if !rule.fn(rv, rule.param) {
+			*errs = append(*errs, &ValidationError{Field: path, Rule: rule.name, Param: rule.param, Value: rv.Interface()})
+			return
+		}
+	}
+
+	if rv, ok := indirect(rv); ok && isNestedStruct(rv.Type()) {
+		validateStruct(rv, path+".", errs)
+	}
+}
+
+// dive validates the elements of slice, array or map by the rules, the
+// other kinds held by interfaces are skipped.
+func dive(rv reflect.Value, path string, rules []validationRule, errs *ValidationErrors) {
+	rv, ok := indirect(rv)
+	if !ok {
+		return
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			validateValue(rv.Index(i), fmt.Sprintf("%s[%d]", path, i), rules, errs)
+		}
+	case reflect.Map:
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, key := range keys {
+			validateValue(rv.MapIndex(key), fmt.Sprintf("%s[%v]", path, key.Interface()), rules, errs)
+		}
+	}
+}
+
+// indirect dereferences the pointers of v, it returns false if v is nil.
+func indirect(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, v.IsValid()
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Invalid:
+		return true
+	}
+	return v.IsZero()
+}
+
+// sizeOf returns the length of strings, slices and maps, or the value
+// of numbers, which is compared by min, max and len.
+func sizeOf(v reflect.Value) (float64, bool) {
+	v, ok := indirect(v)
+	if !ok {
+		return 0, false
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// ruleNumber returns the number of param, which is checked by
+// parseValidationRule.
+func ruleNumber(param string) float64 {
+	n, _ := strconv.ParseFloat(param, 64)
+	return n
+}
@@ -0,0 +1,152 @@
+package shack
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	type item struct {
+		Name string `validate:"required"`
+	}
+	type address struct {
+		City string `validate:"required"`
+	}
+	type user struct {
+		Name    string            `validate:"required,min=2,max=5"`
+		Email   string            `validate:"omitempty,email"`
+		Role    string            `validate:"oneof=admin user"`
+		ID      string            `validate:"len=36"`
+		Age     *int              `validate:"required,min=18"`
+		Tags    []string          `validate:"max=2,dive,min=2"`
+		Items   []item            `validate:"dive"`
+		Labels  map[string]string `validate:"dive,required"`
+		Address address
+		Even    int `validate:"even"`
+		Ignored int `validate:"-"`
+	}
+
+	RegisterValidation("even", func(v reflect.Value, _ string) bool {
+		return v.Int()%2 == 0
+	})
+
+	age := 20
+	valid := user{
+		Name:  "foo",
+		Role:  "admin",
+		ID:    "123e4567-e89b-12d3-a456-426614174000",
+		Age:   &age,
+		Tags:  []string{"ab", "cd"},
+		Items: []item{{"x"}},
+		Labels: map[string]string{
+			"a": "b",
+		},
+		Address: address{"x"},
+	}
+	if err := Validate(&valid); err != nil {
+		t.Fatal(err)
+	}
+
+	age = 10
+	invalid := user{
+		Name:    "foobar",
+		Email:   "foo",
+		Role:    "root",
+		ID:      "1",
+		Age:     &age,
+		Tags:    []string{"a", "bc"},
+		Items:   []item{{"x"}, {""}},
+		Labels:  map[string]string{"a": ""},
+		Address: address{},
+		Even:    1,
+	}
+	err := Validate(invalid)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	expected := map[string]string{
+		"Name":          "must be at most 5",
+		"Email":         "must be a valid email",
+		"Role":          "must be one of admin user",
+		"ID":            "must have length 36",
+		"Age":           "must be at least 18",
+		"Tags[0]":       "must be at least 2",
+		"Items[1].Name": "is required",
+		"Labels[a]":     "is required",
+		"Address.City":  "is required",
+		"Even":          "failed on rule 'even'",
+	}
+	if !reflect.DeepEqual(errs.Map(), expected) {
+		t.Errorf("expected %v, got %v", expected, errs.Map())
+	}
+}
+
+func TestValidateInvalidTags(t *testing.T) {
+	tests := []interface{}{
+		struct {
+			Name string `validate:"min=a"`
+		}{"foo"},
+		struct {
+			Name string `validate:"omitempty,len=x"`
+		}{},
+		struct {
+			Name string `validate:"dive,required"`
+		}{"foo"},
+		struct {
+			Tags []string `validate:"dive,dive"`
+		}{},
+		struct {
+			Name string `validate:"unknown"`
+		}{},
+	}
+	for i, test := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("test %d: expected panic of the invalid tag", i)
+				}
+			}()
+			_ = Validate(test)
+		}()
+	}
+
+	// the kind held by an interface is only known at runtime
+	v := struct {
+		Value interface{} `validate:"dive,required"`
+	}{"foo"}
+	if err := Validate(v); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestContextBindValidate(t *testing.T) {
+	type request struct {
+		Page int    `query:"page" validate:"min=1"`
+		Name string `json:"name" validate:"required"`
+	}
+
+	var err error
+	r := NewRouter()
+	r.POST("/", func(ctx *Context) {
+		var req request
+		err = ctx.Bind(&req)
+	})
+
+	req := httptest.NewRequest(_POST, "/?page=0", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	expected := map[string]string{"Page": "must be at least 1", "Name": "is required"}
+	if !reflect.DeepEqual(errs.Map(), expected) {
+		t.Errorf("expected %v, got %v", expected, errs.Map())
+	}
+}
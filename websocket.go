@@ -0,0 +1,621 @@
+package shack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket message types.
+const (
+	WSTextMessage   = 1
+	WSBinaryMessage = 2
+	WSCloseMessage  = 8
+	WSPingMessage   = 9
+	WSPongMessage   = 10
+
+	wsContinuation = 0
+)
+
+// WebSocket close codes defined in RFC 6455, section 7.4.1.
+const (
+	WSCloseNormalClosure           = 1000
+	WSCloseGoingAway               = 1001
+	WSCloseProtocolError           = 1002
+	WSCloseUnsupportedData         = 1003
+	WSCloseNoStatusReceived        = 1005
+	WSCloseAbnormalClosure         = 1006
+	WSCloseInvalidFramePayloadData = 1007
+	WSClosePolicyViolation         = 1008
+	WSCloseMessageTooBig           = 1009
+	WSCloseMandatoryExtension      = 1010
+	WSCloseInternalServerErr       = 1011
+)
+
+var (
+	ErrWSClosed = errors.New("shack: websocket connection is closed")
+
+	deflateTail     = []byte{0x00, 0x00, 0xff, 0xff}
+	deflateTrailer  = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+	flateWriterPool = sync.Pool{New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	}}
+)
+
+type WSHandler func(*Context, *WSConn)
+
+// WSOption configures the websocket upgrade.
+type WSOption struct {
+	// Subprotocols are the supported protocols in order of preference.
+	Subprotocols []string
+	// CheckOrigin returns true if the request Origin header is acceptable.
+	// By default, only the same host as the request is accepted.
+	CheckOrigin func(r *http.Request) bool
+	// EnableCompression enables the permessage-deflate extension
+	// if the client offers it.
+	EnableCompression bool
+	// ReadLimit is the max size in bytes of a message read from the peer,
+	// 0 means DefaultWSReadLimit, and a negative value means no limit.
+	ReadLimit int64
+}
+
+// DefaultWSReadLimit is the default max size in bytes of a message.
+const DefaultWSReadLimit int64 = 32 << 20
+
+// wsReadChunk is the max size allocated for a frame payload before its
+// data arrives, the larger payloads are read in chunks.
+const wsReadChunk = 64 << 10
+
+// WSCloseError is returned by WSConn.ReadMessage when the connection is closed.
+type WSCloseError struct {
+	Code int
+	Text string
+}
+
+func (e *WSCloseError) Error() string {
+	return fmt.Sprintf("shack: websocket closed with code %d %s", e.Code, e.Text)
+}
+
+// WSConn is a websocket connection upgraded from a request.
+type WSConn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	bw          *bufio.Writer
+	writeMutex  sync.Mutex
+	closeSent   bool
+	readErr     error
+	readLimit   int64
+	compress    bool
+	subprotocol string
+	pingHandler func(data []byte) error
+	pongHandler func(data []byte) error
+}
+
+// WS adds a websocket endpoint, the request is upgraded before handler
+// is called, and the connection is closed after handler returns.
+func (r *Router) WS(pattern string, handler WSHandler, opts ...WSOption) *Route {
+	opt := WSOption{}
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	return r.GET(pattern, func(ctx *Context) {
+		conn, err := upgrade(ctx, opt)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		defer conn.close()
+
+		handler(ctx, conn)
+	})
+}
+
+func upgrade(ctx *Context, opt WSOption) (*WSConn, error) {
+	req := ctx.Request.Request
+	if !headerContainsToken(req.Header, "Connection", "upgrade") ||
+		!headerContainsToken(req.Header, "Upgrade", "websocket") {
+		ctx.Response.Status(http.StatusBadRequest)
+		return nil, errors.New("shack: websocket upgrade headers are missing")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		ctx.Response.Header("Sec-WebSocket-Version", "13")
+		ctx.Response.Status(http.StatusUpgradeRequired)
+		return nil, errors.New("shack: websocket version is not supported")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		ctx.Response.Status(http.StatusBadRequest)
+		return nil, errors.New("shack: websocket key is not valid")
+	}
+	checkOrigin := opt.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(req) {
+		ctx.Response.Status(http.StatusForbidden)
+		return nil, errors.New("shack: websocket origin is not allowed")
+	}
+
+	subprotocol := selectSubprotocol(req, opt.Subprotocols)
+	compress := opt.EnableCompression && acceptDeflate(req)
+
+	netConn, rw, err := ctx.Response.Hijack()
+	if err != nil {
+		ctx.Response.Status(http.StatusInternalServerError)
+		return nil, err
+	}
+	ctx.Response.Status(http.StatusSwitchingProtocols)
+	_ = netConn.SetDeadline(time.Time{})
+
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(h.Sum(nil)) + "\r\n")
+	if len(subprotocol) > 0 {
+		b.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	if compress {
+		b.WriteString("Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n")
+	}
+	b.WriteString("\r\n")
+	if _, err = rw.WriteString(b.String()); err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+
+	conn := &WSConn{
+		conn:        netConn,
+		br:          rw.Reader,
+		bw:          rw.Writer,
+		readLimit:   wsReadLimit(opt.ReadLimit),
+		compress:    compress,
+		subprotocol: subprotocol,
+	}
+	conn.pingHandler = func(data []byte) error {
+		err := conn.WriteMessage(WSPongMessage, data)
+		if errors.Is(err, ErrWSClosed) {
+			return nil
+		}
+		return err
+	}
+	conn.pongHandler = func([]byte) error { return nil }
+	return conn, nil
+}
+
+// Subprotocol returns the negotiated protocol.
+func (c *WSConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// RemoteAddr returns the remote network address.
+func (c *WSConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadLimit sets the max size in bytes of a message read from the peer,
+// 0 means DefaultWSReadLimit, and a negative value means no limit.
+func (c *WSConn) SetReadLimit(limit int64) {
+	c.readLimit = wsReadLimit(limit)
+}
+
+func wsReadLimit(limit int64) int64 {
+	if limit == 0 {
+		return DefaultWSReadLimit
+	}
+	return limit
+}
+
+// SetReadDeadline sets the read deadline on the underlying connection.
+func (c *WSConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline on the underlying connection.
+func (c *WSConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetPingHandler sets the handler for ping messages received from the peer.
+// The default handler replies a pong message with the same data.
+func (c *WSConn) SetPingHandler(handler func(data []byte) error) {
+	c.pingHandler = handler
+}
+
+// SetPongHandler sets the handler for pong messages received from the peer.
+func (c *WSConn) SetPongHandler(handler func(data []byte) error) {
+	c.pongHandler = handler
+}
+
+// ReadMessage reads the next text or binary message, control messages
+// are handled while reading.
+// A *WSCloseError is returned once the peer closes the connection.
+func (c *WSConn) ReadMessage() (messageType int, p []byte, err error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+
+	compressed := false
+	for {
+		var f wsFrame
+		f, err = c.readFrame()
+		if err != nil {
+			c.readErr = err
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case WSPingMessage:
+			if err = c.pingHandler(f.payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case WSPongMessage:
+			if err = c.pongHandler(f.payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case WSCloseMessage:
+			c.readErr = c.handleClose(f.payload)
+			return 0, nil, c.readErr
+		case WSTextMessage, WSBinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(WSCloseProtocolError, "unexpected new message")
+			}
+			if f.rsv1 && !c.compress {
+				return 0, nil, c.fail(WSCloseProtocolError, "unexpected compressed frame")
+			}
+			messageType, compressed, p = f.opcode, f.rsv1, f.payload
+		case wsContinuation:
+			if messageType == 0 {
+				return 0, nil, c.fail(WSCloseProtocolError, "unexpected continuation frame")
+			}
+			if f.rsv1 {
+				return 0, nil, c.fail(WSCloseProtocolError, "unexpected compressed frame")
+			}
+			if c.readLimit > 0 && int64(len(p)+len(f.payload)) > c.readLimit {
+				return 0, nil, c.fail(WSCloseMessageTooBig, "message too big")
+			}
+			p = append(p, f.payload...)
+		default:
+			return 0, nil, c.fail(WSCloseProtocolError, "unknown opcode "+strconv.Itoa(f.opcode))
+		}
+
+		if f.fin {
+			break
+		}
+	}
+
+	if compressed {
+		if p, err = c.decompress(p); err != nil {
+			return 0, nil, err
+		}
+	}
+	if messageType == WSTextMessage && !utf8.Valid(p) {
+		return 0, nil, c.fail(WSCloseInvalidFramePayloadData, "invalid utf8 text")
+	}
+	return messageType, p, nil
+}
+
+// ReadJSON reads the next message and decodes it to v.
+func (c *WSConn) ReadJSON(v interface{}) error {
+	_, p, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(p, v)
+}
+
+// WriteMessage writes a message with the given type,
+// it's safe to call WriteMessage concurrently.
+func (c *WSConn) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case WSTextMessage, WSBinaryMessage:
+		if c.compress {
+			compressed, err := compress(data)
+			if err != nil {
+				return err
+			}
+			return c.writeFrame(messageType, true, compressed)
+		}
+	case WSCloseMessage, WSPingMessage, WSPongMessage:
+		if len(data) > 125 {
+			return errors.New("shack: websocket control message is too big")
+		}
+	default:
+		return errors.New("shack: unknown websocket message type " + strconv.Itoa(messageType))
+	}
+	return c.writeFrame(messageType, false, data)
+}
+
+// WriteJSON encodes v to json and writes it as a text message.
+func (c *WSConn) WriteJSON(v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(WSTextMessage, p)
+}
+
+// Ping sends a ping message to the peer.
+func (c *WSConn) Ping(data []byte) error {
+	return c.WriteMessage(WSPingMessage, data)
+}
+
+// Close sends a close message with the given code and reason to the peer.
+// The connection is closed after the handler returns.
+func (c *WSConn) Close(code int, text string) error {
+	return c.WriteMessage(WSCloseMessage, closePayload(code, text))
+}
+
+func (c *WSConn) close() {
+	_ = c.Close(WSCloseNormalClosure, "")
+	_ = c.conn.Close()
+}
+
+func (c *WSConn) fail(code int, text string) error {
+	_ = c.Close(code, text)
+	c.readErr = &WSCloseError{Code: code, Text: text}
+	return c.readErr
+}
+
+func (c *WSConn) handleClose(payload []byte) error {
+	code, text := WSCloseNoStatusReceived, ""
+	switch {
+	case len(payload) == 1:
+		return c.fail(WSCloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		text = string(payload[2:])
+		if !validCloseCode(code) {
+			return c.fail(WSCloseProtocolError, "invalid close code")
+		}
+		if !utf8.ValidString(text) {
+			return c.fail(WSCloseInvalidFramePayloadData, "invalid utf8 close reason")
+		}
+	}
+
+	var reply []byte
+	if code != WSCloseNoStatusReceived {
+		reply = closePayload(code, "")
+	}
+	_ = c.WriteMessage(WSCloseMessage, reply)
+	return &WSCloseError{Code: code, Text: text}
+}
+
+type wsFrame struct {
+	fin     bool
+	rsv1    bool
+	opcode  int
+	payload []byte
+}
+
+func (c *WSConn) readFrame() (f wsFrame, err error) {
+	var head [8]byte
+	if _, err = io.ReadFull(c.br, head[:2]); err != nil {
+		return
+	}
+	f.fin = head[0]&0x80 != 0
+	f.rsv1 = head[0]&0x40 != 0
+	f.opcode = int(head[0] & 0x0f)
+	if head[0]&0x30 != 0 {
+		return f, c.fail(WSCloseProtocolError, "reserved bits are set")
+	}
+	if head[1]&0x80 == 0 {
+		return f, c.fail(WSCloseProtocolError, "client frame is not masked")
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(c.br, head[:2]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(head[:2]))
+	case 127:
+		if _, err = io.ReadFull(c.br, head[:8]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(head[:8])
+		if length>>63 != 0 {
+			return f, c.fail(WSCloseProtocolError, "invalid payload length")
+		}
+	}
+
+	if f.opcode >= WSCloseMessage {
+		if !f.fin || length > 125 || f.rsv1 {
+			return f, c.fail(WSCloseProtocolError, "invalid control frame")
+		}
+	}
+	if c.readLimit > 0 && length > uint64(c.readLimit) {
+		return f, c.fail(WSCloseMessageTooBig, "message too big")
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	// the length is declared by the peer, so the payload is allocated as
+	// its data arrives rather than by the length.
+	if length <= wsReadChunk {
+		f.payload = make([]byte, length)
+		if _, err = io.ReadFull(c.br, f.payload); err != nil {
+			return
+		}
+	} else {
+		var buf bytes.Buffer
+		buf.Grow(wsReadChunk)
+		if _, err = io.CopyN(&buf, c.br, int64(length)); err != nil {
+			return
+		}
+		f.payload = buf.Bytes()
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i&3]
+	}
+	return
+}
+
+func (c *WSConn) writeFrame(opcode int, rsv1 bool, payload []byte) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.closeSent {
+		return ErrWSClosed
+	}
+
+	var head [10]byte
+	head[0] = 0x80 | byte(opcode)
+	if rsv1 {
+		head[0] |= 0x40
+	}
+	n := 2
+	switch length := len(payload); {
+	case length <= 125:
+		head[1] = byte(length)
+	case length <= 0xffff:
+		head[1] = 126
+		binary.BigEndian.PutUint16(head[2:], uint16(length))
+		n += 2
+	default:
+		head[1] = 127
+		binary.BigEndian.PutUint64(head[2:], uint64(length))
+		n += 8
+	}
+
+	if opcode == WSCloseMessage {
+		c.closeSent = true
+	}
+	if _, err := c.bw.Write(head[:n]); err != nil {
+		return err
+	}
+	if _, err := c.bw.Write(payload); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+func (c *WSConn) decompress(p []byte) ([]byte, error) {
+	fr := flate.NewReader(io.MultiReader(bytes.NewReader(p), bytes.NewReader(deflateTrailer)))
+	defer fr.Close()
+
+	var r io.Reader = fr
+	if c.readLimit > 0 {
+		r = io.LimitReader(fr, c.readLimit+1)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, c.fail(WSCloseInvalidFramePayloadData, "invalid compressed data")
+	}
+	if c.readLimit > 0 && int64(len(out)) > c.readLimit {
+		return nil, c.fail(WSCloseMessageTooBig, "message too big")
+	}
+	return out, nil
+}
+
+func compress(p []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	fw := flateWriterPool.Get().(*flate.Writer)
+	defer flateWriterPool.Put(fw)
+
+	fw.Reset(buf)
+	if _, err := fw.Write(p); err != nil {
+		return nil, err
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), deflateTail), nil
+}
+
+func closePayload(code int, text string) []byte {
+	if code == WSCloseNoStatusReceived {
+		return nil
+	}
+	p := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(p, uint16(code))
+	copy(p[2:], text)
+	return p
+}
+
+func validCloseCode(code int) bool {
+	switch code {
+	case WSCloseNoStatusReceived, WSCloseAbnormalClosure, 1004, 1015:
+		return false
+	}
+	return (code >= 1000 && code <= 1014) || (code >= 3000 && code <= 4999)
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func selectSubprotocol(r *http.Request, supported []string) string {
+	for _, s := range supported {
+		if headerContainsToken(r.Header, "Sec-WebSocket-Protocol", s) {
+			return s
+		}
+	}
+	return ""
+}
+
+func acceptDeflate(r *http.Request) bool {
+	for _, v := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(v, ",") {
+			params := strings.Split(ext, ";")
+			if strings.TrimSpace(params[0]) != "permessage-deflate" {
+				continue
+			}
+			ok := true
+			for _, param := range params[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if kv[0] == "server_max_window_bits" && len(kv) > 1 && strings.Trim(kv[1], `"`) != "15" {
+					ok = false
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, v := range header.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
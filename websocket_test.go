@@ -0,0 +1,254 @@
+package shack
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebSocket(t *testing.T) {
+	r := NewRouter()
+	r.WS("/ws", func(ctx *Context, conn *WSConn) {
+		for {
+			messageType, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = conn.WriteMessage(messageType, p); err != nil {
+				return
+			}
+		}
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	conn, br, resp := dialWS(t, server, "/ws", "")
+	defer conn.Close()
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected accept key:%s", accept)
+	}
+
+	tests := []struct {
+		opcode  byte
+		payload string
+	}{
+		{WSTextMessage, "hello"},
+		{WSPingMessage, "ping"},
+		{WSBinaryMessage, strings.Repeat("x", 300)},
+		{WSBinaryMessage, strings.Repeat("x", 100<<10)},
+	}
+	for i, test := range tests {
+		writeClientFrame(t, conn, test.opcode, []byte(test.payload))
+		opcode, payload := readServerFrame(t, br)
+		expected := test.opcode
+		if expected == WSPingMessage {
+			expected = WSPongMessage
+		}
+		if opcode != expected || string(payload) != test.payload {
+			t.Errorf("input [%d]: expecting opcode:%d payload:%s, got:%d %s", i, expected, test.payload, opcode, payload)
+		}
+	}
+
+	writeClientFrame(t, conn, WSCloseMessage, []byte{0x03, 0xe8})
+	opcode, payload := readServerFrame(t, br)
+	if opcode != WSCloseMessage || binary.BigEndian.Uint16(payload) != WSCloseNormalClosure {
+		t.Errorf("unexpected close frame:%d %v", opcode, payload)
+	}
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	r := NewRouter()
+	r.WS("/ws", func(ctx *Context, conn *WSConn) {
+		for {
+			messageType, p, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = conn.WriteMessage(messageType, p); err != nil {
+				return
+			}
+		}
+	}, WSOption{EnableCompression: true, ReadLimit: 64})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	conn, br, resp := dialWS(t, server, "/ws", "Sec-WebSocket-Extensions: permessage-deflate\r\n")
+	defer conn.Close()
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.HasPrefix(ext, "permessage-deflate") {
+		t.Fatalf("unexpected extensions:%s", ext)
+	}
+
+	// fragmented with a ping between the fragments
+	writeFrame(t, conn, WSTextMessage, []byte("hello "))
+	writeFrame(t, conn, 0x80|WSPingMessage, []byte("ping"))
+	writeFrame(t, conn, 0x80|wsContinuation, []byte("world"))
+	if opcode, payload := readServerFrame(t, br); opcode != WSPongMessage || string(payload) != "ping" {
+		t.Errorf("expecting pong, got:%d %s", opcode, payload)
+	}
+	if opcode, payload := readMessage(t, br); opcode != WSTextMessage || string(payload) != "hello world" {
+		t.Errorf("expecting fragmented message, got:%d %s", opcode, payload)
+	}
+
+	compressed, err := compress([]byte(strings.Repeat("ab", 20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFrame(t, conn, 0x80|0x40|WSBinaryMessage, compressed)
+	if opcode, payload := readMessage(t, br); opcode != WSBinaryMessage || string(payload) != strings.Repeat("ab", 20) {
+		t.Errorf("expecting compressed message, got:%d %s", opcode, payload)
+	}
+}
+
+func TestWebSocketReadLimit(t *testing.T) {
+	r := NewRouter()
+	r.WS("/default", func(ctx *Context, conn *WSConn) {
+		_, _, _ = conn.ReadMessage()
+	})
+	r.WS("/limited", func(ctx *Context, conn *WSConn) {
+		_, _, _ = conn.ReadMessage()
+	}, WSOption{EnableCompression: true, ReadLimit: 16})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	compressed, err := compress([]byte(strings.Repeat("x", 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a header declaring a huge payload without sending it
+	huge := []byte{0x80 | WSBinaryMessage, 0x80 | 127, 0, 0, 1, 0, 0, 0, 0, 0, 1, 2, 3, 4}
+
+	tests := []struct {
+		path   string
+		frames func(w io.Writer)
+	}{
+		{"/default", func(w io.Writer) {
+			_, _ = w.Write(huge)
+		}},
+		{"/limited", func(w io.Writer) {
+			writeClientFrame(t, w, WSBinaryMessage, make([]byte, 17))
+		}},
+		{"/limited", func(w io.Writer) {
+			writeFrame(t, w, WSBinaryMessage, make([]byte, 10))
+			writeFrame(t, w, 0x80|wsContinuation, make([]byte, 10))
+		}},
+		{"/limited", func(w io.Writer) {
+			writeFrame(t, w, 0x80|0x40|WSBinaryMessage, compressed)
+		}},
+	}
+	for i, test := range tests {
+		func() {
+			conn, br, _ := dialWS(t, server, test.path, "Sec-WebSocket-Extensions: permessage-deflate\r\n")
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+			test.frames(conn)
+			opcode, payload := readServerFrame(t, br)
+			if opcode != WSCloseMessage || len(payload) < 2 || binary.BigEndian.Uint16(payload) != WSCloseMessageTooBig {
+				t.Errorf("input [%d]: expecting close 1009, got:%d %v", i, opcode, payload)
+			}
+		}()
+	}
+}
+
+// dialWS upgrades a connection to the path of server, header is the
+// extra request header lines.
+func dialWS(t *testing.T, server *httptest.Server, path, header string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(conn, "GET "+path+" HTTP/1.1\r\nHost: "+server.Listener.Addr().String()+
+		"\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+header+"\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expecting status:101, got:%d", resp.StatusCode)
+	}
+	return conn, br, resp
+}
+
+// readMessage reads a data frame of server, and decompresses it if
+// it's compressed.
+func readMessage(t *testing.T, r *bufio.Reader) (opcode byte, payload []byte) {
+	first, err := r.Peek(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opcode, payload = readServerFrame(t, r)
+	if first[0]&0x40 == 0 {
+		return opcode, payload
+	}
+	fr := flate.NewReader(io.MultiReader(bytes.NewReader(payload), bytes.NewReader(deflateTrailer)))
+	defer fr.Close()
+	if payload, err = io.ReadAll(fr); err != nil {
+		t.Fatal(err)
+	}
+	return opcode, payload
+}
+
+func writeClientFrame(t *testing.T, w io.Writer, opcode byte, payload []byte) {
+	writeFrame(t, w, 0x80|opcode, payload)
+}
+
+// writeFrame writes a masked frame, first is the first byte of frame
+// including the fin and rsv1 bits and the opcode.
+func writeFrame(t *testing.T, w io.Writer, first byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{first}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, 0x80|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+	default:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i&3])
+	}
+	if _, err := w.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readServerFrame(t *testing.T, r io.Reader) (opcode byte, payload []byte) {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	length := int(head[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			t.Fatal(err)
+		}
+		length = int(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			t.Fatal(err)
+		}
+		length = int(binary.BigEndian.Uint64(ext))
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0f, payload
+}